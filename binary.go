@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+// binaryMarshalerType is the type of values serialized to bytes, such as
+// time.Time.
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+
+// isBinaryMarshaler returns true if values of type 't' are scrubbed by
+// scrubBinary. Values of string kinds are scrubbed as strings instead.
+func isBinaryMarshaler(t reflect.Type) bool {
+	if t.Kind() == reflect.String || t.Kind() == reflect.Interface {
+		return false
+	}
+
+	return t.Implements(binaryMarshalerType) || reflect.PtrTo(t).Implements(binaryMarshalerType)
+}
+
+// scrubBinary scrubs the value 'targetValue' at 'path', which implements
+// encoding.BinaryMarshaler: it is replaced by the zero value of its type,
+// round-tripped through its binary encoding with its
+// encoding.BinaryUnmarshaler implementation. It saves a function to restore
+// the original value in 'state'.
+//
+// Values which don't implement encoding.BinaryUnmarshaler can't be scrubbed
+// and are left as is; in strict mode, they stop the scrubbing with
+// ErrNotScrubbable.
+func scrubBinary(targetValue reflect.Value, path string, state *scrubState) {
+	if !targetValue.CanAddr() || !targetValue.Addr().CanInterface() || targetValue.IsZero() {
+		return
+	}
+
+	unmarshaler, ok := targetValue.Addr().Interface().(encoding.BinaryUnmarshaler)
+	if !ok || !targetValue.CanSet() {
+		state.fail(fmt.Errorf("%w: %s: %s doesn't implement encoding.BinaryUnmarshaler",
+			ErrNotScrubbable, path, targetValue.Type()))
+		return
+	}
+
+	zero := reflect.New(targetValue.Type())
+	marshaler, ok := zero.Interface().(encoding.BinaryMarshaler)
+	if !ok {
+		marshaler = zero.Elem().Interface().(encoding.BinaryMarshaler)
+	}
+
+	data, err := marshaler.MarshalBinary()
+	if err != nil {
+		state.fail(fmt.Errorf("%w: %s: %v", ErrNotScrubbable, path, err))
+		return
+	}
+
+	saved := reflect.New(targetValue.Type()).Elem()
+	saved.Set(targetValue)
+	restore := func() { targetValue.Set(saved) }
+
+	if err := unmarshaler.UnmarshalBinary(data); err != nil {
+		restore()
+		state.fail(fmt.Errorf("%w: %s: %v", ErrNotScrubbable, path, err))
+		return
+	}
+
+	state.saveRestoreFunc(restore)
+	state.report(path, fmt.Sprint(saved.Interface()))
+}
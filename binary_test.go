@@ -0,0 +1,87 @@
+package scrub
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Location is a value serialized to bytes, with unexported coordinates.
+type Location struct {
+	lat, lng int32
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (l Location) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(l.lat))
+	binary.BigEndian.PutUint32(data[4:], uint32(l.lng))
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (l *Location) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("bad location")
+	}
+
+	l.lat = int32(binary.BigEndian.Uint32(data))
+	l.lng = int32(binary.BigEndian.Uint32(data[4:]))
+	return nil
+}
+
+// MarshalJSON marshals the coordinates, like a careless type would.
+func (l Location) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%d,%d", l.lat, l.lng))
+}
+
+// Checksum is a value serialized to bytes which can't be unmarshalled.
+type Checksum struct {
+	Sum uint32
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (c Checksum) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, c.Sum)
+	return data, nil
+}
+
+// Struct with values serialized to bytes
+type Visit struct {
+	Place    string
+	Home     Location
+	Work     *Location
+	Birthday time.Time
+	Checksum Checksum
+}
+
+// TestScrubBinaryMarshaler tests scrubbing values serialized to bytes.
+func TestScrubBinaryMarshaler(t *testing.T) {
+	birthday := time.Date(1990, time.May, 4, 0, 0, 0, 0, time.UTC)
+	visit := &Visit{
+		Place:    "Park",
+		Home:     Location{lat: 37, lng: -122},
+		Work:     &Location{lat: 40, lng: -74},
+		Birthday: birthday,
+		Checksum: Checksum{Sum: 42},
+	}
+
+	validateScrub(t, visit, json.RawMessage(`{"Place":"Park","Home":"0,0","Work":"0,0",`+
+		`"Birthday":"0001-01-01T00:00:00Z","Checksum":{"Sum":42}}`),
+		map[string]bool{"home": true, "work": true, "birthday": true})
+
+	// Values which can't be unmarshalled are left as is, unless in strict mode.
+	got := Scrub(visit, map[string]bool{"checksum": true})
+	assert.Contains(t, got, `"Checksum":{"Sum":42}`)
+
+	_, err := NewScrubber(map[string]FieldScrubOptioner{"checksum": nil},
+		WithStrict(true)).Scrub(visit)
+	assert.ErrorIs(t, err, ErrNotScrubbable)
+	assert.Contains(t, err.Error(), "Checksum")
+}
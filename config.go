@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fieldConfig is the configuration of a field to scrub in a configuration
+// file, see LoadFields.
+type fieldConfig struct {
+	Token     string         `json:"token" yaml:"token"`
+	Strategy  string         `json:"strategy" yaml:"strategy"`
+	Symbol    string         `json:"symbol" yaml:"symbol"`
+	Partial   *partialConfig `json:"partial" yaml:"partial"`
+	Subtree   bool           `json:"subtree" yaml:"subtree"`
+	NonString bool           `json:"nonstring" yaml:"nonstring"`
+	Drop      bool           `json:"drop" yaml:"drop"`
+}
+
+// partialConfig is the number of visible first and last characters of a
+// field in a configuration file, see LoadFields.
+type partialConfig struct {
+	First int `json:"first" yaml:"first"`
+	Last  int `json:"last" yaml:"last"`
+}
+
+// LoadFields reads the fields to scrub from a configuration in 'format'
+// (JSONScrub or YAMLScrub) read from 'r', so that they can be managed
+// without code changes. The configuration maps each field name to its
+// options, all optional, e.g. in YAML:
+//
+//	password: {}
+//	pin:
+//	  token: "<pin>"
+//	session:
+//	  strategy: jwt
+//	card:
+//	  symbol: "#"
+//	  partial: {first: 6, last: 4}
+//	profile:
+//	  subtree: true
+//	account:
+//	  nonstring: true
+//	debug:
+//	  drop: true
+//
+// "token", "symbol", "subtree", "nonstring" and "drop" set
+// FieldScrubOptions.Token, Symbol, MaskSubtree, ScrubNonString and Drop,
+// "partial" sets ShowFirst and ShowLast, and "strategy" sets Strategy to
+// JWTSignatureMask ("jwt"), FormatPreservingMask ("format"),
+// CasePreservingMask ("case") or DigestSuffixMask ("digest"). It returns an
+// error wrapping ErrInvalidConfig if the configuration is invalid, including
+// when it has unknown keys.
+func LoadFields(r io.Reader, format DataType) (map[string]FieldScrubOptioner, error) {
+	var configs map[string]*fieldConfig
+	var err error
+
+	switch format {
+	case "", JSONScrub:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&configs)
+	case YAMLScrub:
+		decoder := yaml.NewDecoder(r)
+		decoder.KnownFields(true)
+		err = decoder.Decode(&configs)
+	default:
+		return nil, fmt.Errorf("%w: unknown data type %q", ErrInvalidConfig, format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	fields := make(map[string]FieldScrubOptioner, len(configs))
+	for name, config := range configs {
+		mask := NewMask()
+		if config == nil {
+			fields[name] = mask
+			continue
+		}
+
+		if config.Strategy != "" {
+			strategy, ok := namedStrategies[config.Strategy]
+			if !ok {
+				return nil, fmt.Errorf("%w: field %q: unknown strategy %q",
+					ErrInvalidConfig, name, config.Strategy)
+			}
+
+			mask = mask.Strategy(strategy)
+		}
+
+		if partial := config.Partial; partial != nil {
+			if partial.First < 0 || partial.Last < 0 {
+				return nil, fmt.Errorf("%w: field %q: negative number of visible characters",
+					ErrInvalidConfig, name)
+			}
+
+			mask = mask.Partial(partial.First, partial.Last)
+		}
+
+		fields[name] = mask.Token(config.Token).Symbol(config.Symbol).MaskSubtree(config.Subtree).
+			ScrubNonString(config.NonString).Drop(config.Drop)
+	}
+
+	return fields, nil
+}
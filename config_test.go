@@ -0,0 +1,104 @@
+package scrub
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadFields tests loading the fields to scrub from configuration files.
+func TestLoadFields(t *testing.T) {
+	configs := map[DataType]string{
+		YAMLScrub: `
+password: {}
+pin:
+  token: "<pin>"
+session:
+  strategy: jwt
+address:
+  subtree: true
+codes:
+`,
+		JSONScrub: `{
+			"password": {},
+			"pin": {"token": "<pin>"},
+			"session": {"strategy": "jwt"},
+			"address": {"subtree": true},
+			"codes": null
+		}`,
+	}
+
+	profile := &Profile{
+		Name:    "John Doe",
+		Email:   "john@example.com",
+		PIN:     "1234",
+		Session: "aGVhZGVy.cGF5bG9hZA.c2ln",
+		Codes:   []string{"code1"},
+		Address: Address{Street: "1 Main St", City: "Springfield"},
+	}
+
+	for format, config := range configs {
+		fields, err := LoadFields(strings.NewReader(config), format)
+		assert.NoError(t, err, "format %s", format)
+		assert.Len(t, fields, 5)
+		assert.Equal(t, &FieldScrubOptions{Token: "<pin>"}, fields["pin"].ScrubOptions())
+
+		// Email is scrubbed as per its struct tag.
+		profileScrubbed := &Profile{
+			Name:    "John Doe",
+			Email:   "****@*******.***",
+			PIN:     "<pin>",
+			Session: "aGVhZGVy.cGF5bG9hZA.********",
+			Codes:   []string{"********"},
+			Address: Address{Street: "********", City: "********"},
+		}
+		validateScrubFields(t, profile, profileScrubbed, fields)
+	}
+}
+
+// TestLoadFieldsDrop tests loading fields to drop from configuration files.
+func TestLoadFieldsDrop(t *testing.T) {
+	fields, err := LoadFields(strings.NewReader("password:\n  drop: true\n"), YAMLScrub)
+	assert.NoError(t, err)
+	assert.Equal(t, &FieldScrubOptions{Drop: true}, fields["password"].ScrubOptions())
+}
+
+// TestLoadFieldsPartial tests loading fields masked partially, with their own
+// symbol, from configuration files.
+func TestLoadFieldsPartial(t *testing.T) {
+	configs := map[DataType]string{
+		YAMLScrub: "email:\n  symbol: \"#\"\n  partial: {first: 2, last: 4}\n",
+		JSONScrub: `{"email": {"symbol": "#", "partial": {"first": 2, "last": 4}}}`,
+	}
+
+	for format, config := range configs {
+		fields, err := LoadFields(strings.NewReader(config), format)
+		assert.NoError(t, err, "format %s", format)
+		assert.Equal(t, &FieldScrubOptions{Symbol: "#", ShowFirst: 2, ShowLast: 4},
+			fields["email"].ScrubOptions())
+
+		got := ScrubFields(&Profile{Email: "john@example.com"}, fields)
+		assert.Contains(t, got, `"Email":"jo########.com"`, "format %s", format)
+	}
+}
+
+// TestLoadFieldsInvalid tests loading invalid configuration files.
+func TestLoadFieldsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		format DataType
+		config string
+	}{
+		{JSONScrub, `{"password": {"strategy": "rot13"}}`},
+		{JSONScrub, `{"password": {"tokn": "<pw>"}}`},
+		{JSONScrub, `["password"]`},
+		{YAMLScrub, "password:\n  tokn: <pw>\n"},
+		{JSONScrub, `{"card": {"partial": {"first": 6, "lst": 4}}}`},
+		{YAMLScrub, "card:\n  partial: {first: 6, lst: 4}\n"},
+		{YAMLScrub, "card:\n  partial: {first: -1}\n"},
+		{"xml", `<password/>`},
+	} {
+		_, err := LoadFields(strings.NewReader(tc.config), tc.format)
+		assert.ErrorIs(t, err, ErrInvalidConfig, "config %s", tc.config)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+)
+
+// ScrubCSV scrubs the CSV document read from 'r' and writes it to 'w',
+// without a Go struct: the names of the columns, given by the header row,
+// take the role of the field names, and are compared as field names are. It
+// streams the document row by row, so that large documents are not loaded
+// in memory at once. The header row is written as is, and the cells of the
+// columns to scrub are masked, including partially. Rows may have fewer or
+// more cells than the header; the extra cells have no column name. Quoted
+// cells are handled as by encoding/csv, which also decides how the output is
+// quoted. It returns the error of reading or writing the document, if any.
+func ScrubCSV(w io.Writer, r io.Reader, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) error {
+	state := newScrubState(fieldsToScrub, opts)
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	writer := csv.NewWriter(w)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	// The columns are at depth 0, like the fields of a struct.
+	state.depth = 0
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for i, cell := range record {
+			var name string
+			if i < len(header) {
+				name = header[i]
+			}
+
+			record[i] = scrubText(cell, name, fieldPath(indexPath("", row), name), state)
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,39 @@
+package scrub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScrubCSV tests scrubbing the columns of CSV documents.
+func TestScrubCSV(t *testing.T) {
+	input := "user,Password,api_key,note\n" +
+		"john,hunter2,key_123456,\"hello, world\"\n" +
+		"jane,\"pass,word\",key_abcdef,\"said \"\"hi\"\"\"\n" +
+		"bob,,key_x\n"
+
+	want := "user,Password,api_key,note\n" +
+		"john,hun********,key********,\"hello, world\"\n" +
+		"jane,pas********,key********,\"said \"\"hi\"\"\"\n" +
+		"bob,,********\n"
+
+	var out bytes.Buffer
+	err := ScrubCSV(&out, strings.NewReader(input), map[string]FieldScrubOptioner{
+		"password": nil,
+		"API_KEY":  nil,
+	}, WithAlwaysShowFirst(3))
+	assert.NoError(t, err)
+	assert.Equal(t, want, out.String())
+
+	// Empty documents are left empty.
+	out.Reset()
+	assert.NoError(t, ScrubCSV(&out, strings.NewReader(""), nil))
+	assert.Empty(t, out.String())
+
+	// Invalid documents.
+	err = ScrubCSV(&out, strings.NewReader("user,password\njohn,\"hunter2\n"), nil)
+	assert.Error(t, err)
+}
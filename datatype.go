@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DataType is the format of the string returned for a scrubbed value, set
+// with WithDataType.
+type DataType string
+
+const (
+	// JSONScrub returns scrubbed values as JSON. It is the default.
+	JSONScrub DataType = "json"
+
+	// YAMLScrub returns scrubbed values as YAML.
+	YAMLScrub DataType = "yaml"
+)
+
+// encode writes 'v' formatted as 'dataType' to 'buf'. An empty 'dataType'
+// selects JSONScrub. Unlike encodeTo, JSON is not followed by a newline. On
+// error, 'buf' is left as it was.
+func encode(buf *bytes.Buffer, v interface{}, dataType DataType) error {
+	start := buf.Len()
+	if err := encodeTo(buf, v, dataType); err != nil {
+		buf.Truncate(start)
+		return err
+	}
+
+	if dataType == "" || dataType == JSONScrub {
+		// Drop the newline written by encodeTo, like json.Marshal.
+		buf.Truncate(buf.Len() - 1)
+	}
+
+	return nil
+}
+
+// encodeTo writes 'v' formatted as 'dataType' to 'w', with a newline after
+// JSON as json.Encoder writes. An empty 'dataType' selects JSONScrub.
+func encodeTo(w io.Writer, v interface{}, dataType DataType) error {
+	var err error
+	switch dataType {
+	case "", JSONScrub:
+		err = json.NewEncoder(w).Encode(v)
+	case YAMLScrub:
+		encoder := yaml.NewEncoder(w)
+		if err = encoder.Encode(v); err == nil {
+			err = encoder.Close()
+		}
+	default:
+		return fmt.Errorf("%w: unknown data type %q", ErrInvalidConfig, dataType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("scrub: marshal: %w", err)
+	}
+
+	return nil
+}
+
+// encode is like the encode function, formatting 'v' as set with WithDataType, with the
+// scrubbed outputs of its json.Marshaler values substituted.
+func (s *scrubState) encode(buf *bytes.Buffer, v interface{}) error {
+	start := buf.Len()
+	if err := encode(buf, v, s.opts.dataType); err != nil || len(s.substitutions) == 0 {
+		return err
+	}
+
+	data := substituteJSON(buf.Bytes()[start:], s.substitutions)
+	buf.Truncate(start)
+	buf.Write(data)
+	return nil
+}
+
+// encodeTo is like the encodeTo function, formatting 'v' as set with WithDataType, with the
+// scrubbed outputs of its json.Marshaler values substituted. The formatted
+// 'v' is built in memory only if there is anything to substitute.
+func (s *scrubState) encodeTo(w io.Writer, v interface{}) error {
+	if len(s.substitutions) == 0 {
+		return encodeTo(w, v, s.opts.dataType)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeTo(&buf, v, s.opts.dataType); err != nil {
+		return err
+	}
+
+	_, err := w.Write(substituteJSON(buf.Bytes(), s.substitutions))
+	return err
+}
@@ -0,0 +1,45 @@
+package scrub
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// Struct with an error field
+type Job struct {
+	Name     string
+	Password string
+	Err      error
+}
+
+// TestScrubYAML tests scrubbing with the output formatted as YAML.
+func TestScrubYAML(t *testing.T) {
+	job := &Job{Name: "backup", Password: "hunter2", Err: errors.New("bad password hunter2")}
+	jobScrubbed := &Job{Name: "backup", Password: "********", Err: errors.New("********")}
+
+	want, _ := yaml.Marshal(map[string]string{
+		"name": jobScrubbed.Name, "password": jobScrubbed.Password, "err": jobScrubbed.Err.Error(),
+	})
+
+	got := Scrub(job, map[string]bool{"password": true, "err": true}, WithDataType(YAMLScrub))
+	assert.YAMLEq(t, string(want), got)
+	assert.Equal(t, "hunter2", job.Password)
+
+	got = Scrub(nil, nil, WithDataType(YAMLScrub))
+	assert.Equal(t, "null\n", got)
+
+	// JSON is the default data type.
+	assert.Equal(t, Scrub(job, nil), Scrub(job, nil, WithDataType(JSONScrub)))
+}
+
+// TestScrubUnknownDataType tests scrubbing with an unknown data type.
+func TestScrubUnknownDataType(t *testing.T) {
+	job := &Job{Name: "backup", Password: "hunter2"}
+
+	_, err := ScrubE(job, nil, WithDataType("xml"))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.Equal(t, "hunter2", job.Password)
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// highEntropy returns true if 'value' looks like a secret as per the options
+// set with WithEntropyDetection.
+func (o *options) highEntropy(value string) bool {
+	if o.minEntropy <= 0 || utf8.RuneCountInString(value) < o.minEntropyLength {
+		return false
+	}
+
+	return shannonEntropy(value) > o.minEntropy
+}
+
+// shannonEntropy returns the Shannon entropy of the characters of 'value', in
+// bits per character.
+func shannonEntropy(value string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range value {
+		counts[r]++
+		total++
+	}
+
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
@@ -0,0 +1,53 @@
+package scrub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestShannonEntropy tests computing the entropy of strings.
+func TestShannonEntropy(t *testing.T) {
+	assert.Equal(t, 0.0, shannonEntropy(""))
+	assert.Equal(t, 0.0, shannonEntropy("aaaa"))
+	assert.Equal(t, 1.0, shannonEntropy("abab"))
+	assert.Equal(t, 2.0, shannonEntropy("abcd"))
+	assert.Equal(t, 2.0, shannonEntropy("東京大阪"))
+}
+
+// TestScrubEntropyDetection tests scrubbing strings which look like secrets
+// whatever their names.
+func TestScrubEntropyDetection(t *testing.T) {
+	apiKey := "sk_9fQ2xLr7TzW4pKd8VbN3mHy6"
+	sentence := "please retry the request later"
+
+	users := &Users{
+		Secret:   "hunter2",
+		Keys:     []string{apiKey, sentence, "Zx8"},
+		UserInfo: []User{{Username: apiKey}},
+	}
+
+	usersScrubbed := &Users{
+		Secret:   "********",
+		Keys:     []string{"********", sentence, "Zx8"},
+		UserInfo: []User{{Username: "********"}},
+	}
+
+	got := Scrub(users, map[string]bool{"secret": true}, WithEntropyDetection(4, 20))
+	want := Scrub(usersScrubbed, map[string]bool{})
+	assert.Equal(t, want, got)
+	assert.Equal(t, apiKey, users.Keys[0])
+
+	// Excluded fields are never scrubbed.
+	got = Scrub(users, map[string]bool{}, WithEntropyDetection(4, 20),
+		WithExcludedFields("username"))
+	assert.Contains(t, got, `"Username":"`+apiKey+`"`)
+	assert.NotContains(t, got, `"Keys":["`+apiKey)
+
+	// Raw JSON is scrubbed alike.
+	batch := &Batch{Records: []json.RawMessage{[]byte(`{"note":"` + apiKey + `","id":"abc"}`)}}
+	got = Scrub(batch, map[string]bool{}, WithEntropyDetection(4, 20))
+	assert.NotContains(t, got, apiKey)
+	assert.Contains(t, got, `"id":"abc"`)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// errorType is the type of 'error' fields, whose messages are scrubbed.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// scrubbedError replaces a sensitive error while it is being scrubbed.
+// Its message is the masked message of the original error, and it wraps
+// the scrubbed form of the error wrapped by the original error, if any.
+type scrubbedError struct {
+	msg     string
+	wrapped error
+}
+
+// Error returns the masked message of the original error.
+func (e *scrubbedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the scrubbed form of the error wrapped by the original error.
+func (e *scrubbedError) Unwrap() error {
+	return e.wrapped
+}
+
+// MarshalJSON marshals the error as its masked message.
+func (e *scrubbedError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.msg)
+}
+
+// MarshalYAML marshals the error as its masked message.
+func (e *scrubbedError) MarshalYAML() (interface{}, error) {
+	return e.msg, nil
+}
+
+// scrubError returns a chain of scrubbedErrors with the same depth as the
+// chain of errors wrapped by 'err' (see errors.Unwrap), in which the message
+// of each layer is masked as per 'fieldOpts' and 'state', as the error at
+// 'path'. Masking each layer
+// keeps a secret of an inner error from leaking through any of the outer
+// errors, whose messages usually embed it.
+func scrubError(err error, fieldOpts FieldScrubOptioner, path string, state *scrubState) error {
+	if err == nil {
+		return nil
+	}
+
+	return &scrubbedError{
+		msg:     maskValue(err.Error(), fieldOpts, path, state),
+		wrapped: scrubError(errors.Unwrap(err), fieldOpts, path, state),
+	}
+}
@@ -0,0 +1,52 @@
+package scrub
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Struct with an error field
+type Failure struct {
+	Op  string
+	Err error
+}
+
+// TestScrubErrorChain tests scrubbing a sensitive error wrapped several times.
+func TestScrubErrorChain(t *testing.T) {
+	root := errors.New("invalid password hunter2")
+	err := fmt.Errorf("login: %w", fmt.Errorf("auth: %w", root))
+	failure := &Failure{Op: "login", Err: err}
+
+	got := Scrub(failure, map[string]bool{"err": true})
+	assert.Equal(t, `{"Op":"login","Err":"********"}`, got)
+	assert.NotContains(t, got, "hunter2")
+
+	got = Scrub(failure, map[string]bool{"err": true}, WithAlwaysShowFirst(5))
+	assert.Equal(t, `{"Op":"login","Err":"login********"}`, got)
+
+	// The original error must be restored after scrubbing.
+	assert.Equal(t, err, failure.Err)
+	assert.ErrorIs(t, failure.Err, root)
+
+	// A nil error is left as is.
+	failure.Err = nil
+	assert.Equal(t, `{"Op":"login","Err":null}`, Scrub(failure, map[string]bool{"err": true}))
+}
+
+// TestScrubErrorLayers tests masking each layer of a wrapped error.
+func TestScrubErrorLayers(t *testing.T) {
+	root := errors.New("invalid password hunter2")
+	err := fmt.Errorf("login: %w", fmt.Errorf("auth: %w", root))
+
+	scrubbed := scrubError(err, nil, "Err", newScrubState(nil, []Option{WithAlwaysShowFirst(2)}))
+
+	var layers []string
+	for e := scrubbed; e != nil; e = errors.Unwrap(e) {
+		layers = append(layers, e.Error())
+	}
+
+	assert.Equal(t, []string{"lo********", "au********", "in********"}, layers)
+}
@@ -0,0 +1,96 @@
+package scrub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// FuzzScrubJSON tests that scrubbing any JSON document doesn't panic, and
+// returns valid JSON for valid documents.
+func FuzzScrubJSON(f *testing.F) {
+	for _, seed := range []string{
+		`{"username":"John Doe","password":"John_Doe's_Password"}`,
+		`{"user":{"Password":"Jane_Doe's_Password","age":42.50}}`,
+		`[{"password":["p1","p2"]}]`,
+		`{"password":null,"token":{},"secrets":[null,{"a":[]}]}`,
+		`{"pin":1234,"admin":true,"ssn":987.65}`,
+		`{"password":"ab","token":"日本語のパスワード"}`,
+		`{"card":"4111 1111 1111 1111","note":"mail john@example.com"}`,
+		`"<a & b>"`,
+		`{"a":1} {}`,
+		``,
+	} {
+		f.Add([]byte(seed), 2)
+	}
+
+	nonString := NewMask().ScrubNonString(true)
+	fields := map[string]FieldScrubOptioner{
+		"password": nil,
+		"token":    NewMask().Strategy(JWTSignatureMask),
+		"secrets":  NewMask().MaskSubtree(true),
+		"pin":      nonString,
+		"admin":    nonString,
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte, showFirst int) {
+		got, err := ScrubJSON(raw, fields, WithAlwaysShowFirst(showFirst),
+			WithValueMatchers(CreditCardPattern, EmailPattern))
+		if err != nil {
+			return
+		}
+
+		assert.True(t, json.Valid(got), "invalid output %q for %q", got, raw)
+		assert.True(t, json.Valid(raw), "invalid input %q accepted", raw)
+	})
+}
+
+// FuzzScrub tests that scrubbing structs holding any values doesn't panic,
+// and restores the original values.
+func FuzzScrub(f *testing.F) {
+	for _, seed := range []struct {
+		password  string
+		key       string
+		showFirst int
+		maxLen    bool
+	}{
+		{"John_Doe's_Password", "key_1", 0, false},
+		{"", "", 3, true},
+		{"ab", "日本語", 2, false},
+		{"パスワード", "k", 100, true},
+		{"p", "\xff\xfe", -1, false},
+	} {
+		f.Add(seed.password, seed.key, seed.showFirst, seed.maxLen)
+	}
+
+	f.Fuzz(func(t *testing.T, password, key string, showFirst int, maskLenVary bool) {
+		users := &Users{
+			Secret:   password,
+			Keys:     []string{key},
+			UserInfo: []User{{Username: key, Password: password, DbSecrets: []string{password}}},
+		}
+
+		events := &Events{
+			Events: []map[string]interface{}{
+				{"password": password, "keys": []interface{}{key, nil, 42}, key: password},
+				nil,
+			},
+		}
+
+		opts := []Option{WithAlwaysShowFirst(showFirst), WithMaskLenVary(maskLenVary)}
+		fields := map[string]FieldScrubOptioner{
+			"password": nil, "secret": nil, "dbsecrets": nil, key: nil,
+		}
+		for _, input := range []interface{}{users, events} {
+			got, err := ScrubE(input, fields, opts...)
+			assert.NoError(t, err)
+			assert.True(t, json.Valid([]byte(got)))
+		}
+
+		assert.Equal(t, password, users.Secret)
+		assert.Equal(t, password, users.UserInfo[0].Password)
+		assert.Equal(t, password, users.UserInfo[0].DbSecrets[0])
+		assert.Equal(t, password, events.Events[0]["password"])
+	})
+}
@@ -0,0 +1,672 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// rawMessageType is the type of raw JSON values, which are scrubbed without
+// a schema.
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// jsonMarshalerType is the type of values marshalled to JSON by their own
+// MarshalJSON method.
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// jsonSubstitution is the scrubbed JSON 'replace' of a json.Marshaler, to
+// substitute for its JSON 'find' at 'path' in the formatted input.
+type jsonSubstitution struct {
+	path    []jsonStep
+	find    []byte
+	replace []byte
+}
+
+// jsonObject is a JSON object decoded by ScrubJSON, which keeps the order of
+// its members.
+type jsonObject []jsonMember
+
+// jsonMember is a member of a jsonObject.
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler, marshalling the members in order.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if err := encodeJSON(&buf, member.key); err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte(':')
+		if err := encodeJSON(&buf, member.value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// encodeJSON writes the JSON encoding of 'v' to 'buf', without escaping
+// HTML characters, so that they are written as they were read.
+func encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+
+	// Drop the newline written by Encode.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// ScrubJSON scrubs the JSON document 'raw' without a Go struct, like raw JSON
+// values held by json.RawMessage fields, and returns the scrubbed document:
+// the keys of JSON objects take the role of the field names. Unlike
+// scrubbing a value decoded into a struct, it keeps the members of the
+// objects in their order, as well as those which no struct would know of. The
+// document is compacted. It returns an error wrapping ErrInvalidInput if
+// 'raw' is not a single JSON value, or an error stopping the scrubbing in
+// strict mode.
+func ScrubJSON(raw []byte, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	data, err := decodeJSON(decoder)
+	if err == nil {
+		if _, err = decoder.Token(); errors.Is(err, io.EOF) {
+			err = nil
+		} else if err == nil {
+			err = errors.New("data after the JSON value")
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	state := newScrubState(fieldsToScrub, opts)
+	data = scrubSchemaless(data, "", "", state)
+	if state.err != nil {
+		return nil, state.err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeJSON decodes the next JSON value of 'decoder', with its objects as
+// jsonObject to keep the order of their members.
+func decodeJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := jsonObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			object = append(object, jsonMember{key: key.(string), value: value})
+		}
+
+		_, err = decoder.Token()
+		return object, err
+
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+		}
+
+		_, err = decoder.Token()
+		return array, err
+	}
+
+	return token, nil
+}
+
+// scrubRawMessage scrubs the raw JSON held by 'targetValue' without a schema
+// (see scrubSchemaless), where 'fieldName' and 'path' are the name and the path
+// of the field holding it. It saves a function to restore the original JSON in
+// 'state'. The members of objects are kept in their order. Raw JSON which
+// can't be decoded, or in which nothing is masked, is left as is.
+func scrubRawMessage(targetValue reflect.Value, fieldName, path string, state *scrubState) {
+	if !targetValue.CanSet() || targetValue.Len() == 0 {
+		return
+	}
+
+	original := targetValue.Bytes()
+
+	decoder := json.NewDecoder(bytes.NewReader(original))
+	decoder.UseNumber()
+	data, err := decodeJSON(decoder)
+	if err != nil {
+		return
+	}
+
+	masked := state.masked
+	data = scrubSchemaless(data, fieldName, path, state)
+	if state.masked == masked {
+		// Nothing was masked: leave the raw JSON as it was written.
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, data); err != nil {
+		return
+	}
+
+	state.saveRestoreFunc(func() { targetValue.SetBytes(original) })
+	targetValue.SetBytes(buf.Bytes())
+}
+
+// jsonMarshalerTypes caches the result of isJSONMarshaler by type.
+var jsonMarshalerTypes sync.Map
+
+// isJSONMarshaler returns whether values of type 't' are marshalled to JSON
+// by their own MarshalJSON method.
+func isJSONMarshaler(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface {
+		return false
+	}
+
+	if ok, found := jsonMarshalerTypes.Load(t); found {
+		return ok.(bool)
+	}
+
+	ok := t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType)
+	jsonMarshalerTypes.Store(t, ok)
+
+	return ok
+}
+
+// jsonMarshaler returns the json.Marshaler of 'targetValue', if any, as
+// encoding/json finds it: pointer methods are used only if 'targetValue' is
+// addressable.
+func jsonMarshaler(targetValue reflect.Value) (json.Marshaler, bool) {
+	if !targetValue.CanInterface() {
+		return nil, false
+	}
+
+	if targetValue.Type().Implements(jsonMarshalerType) {
+		marshaler, ok := targetValue.Interface().(json.Marshaler)
+		return marshaler, ok
+	}
+
+	if targetValue.CanAddr() && reflect.PtrTo(targetValue.Type()).Implements(jsonMarshalerType) {
+		marshaler, ok := targetValue.Addr().Interface().(json.Marshaler)
+		return marshaler, ok
+	}
+
+	return nil, false
+}
+
+// marshalJSON returns the output of 'marshaler' decoded by decodeJSON.
+func marshalJSON(marshaler json.Marshaler) (interface{}, error) {
+	out, err := marshaler.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	decoder.UseNumber()
+	return decodeJSON(decoder)
+}
+
+// enterMarshaler starts scrubbing 'targetValue', named 'fieldName' at 'path',
+// whose MarshalJSON method may output secrets which are not reachable through
+// its fields. It returns a function which scrubs that output once
+// 'targetValue' itself is scrubbed, see scrubMarshaler. The outputs of the
+// json.Marshaler values nested in it, or formatted nowhere, are not scrubbed
+// separately.
+func (s *scrubState) enterMarshaler(targetValue reflect.Value, fieldName,
+	path string) func() {
+	marshaler, ok := jsonMarshaler(targetValue)
+	if !ok || s.marshaling > 0 || s.hiddenJSON() {
+		return func() {}
+	}
+
+	if sub, ok := s.marshaled[leafOf(targetValue)]; ok {
+		// This value was reached through another pointer, and is already
+		// scrubbed: its output is substituted at this position too.
+		if sub != nil {
+			s.substitutions = append(s.substitutions, jsonSubstitution{
+				path: append([]jsonStep(nil), s.jsonPath...), find: sub.find, replace: sub.replace})
+		}
+		return func() {}
+	}
+
+	// The output before the scrubbing tells apart the values masked through
+	// the fields of 'targetValue'.
+	original, err := marshalJSON(marshaler)
+	if err != nil {
+		// Formatting the input fails as well.
+		return func() {}
+	}
+
+	s.marshaling++
+	return func() {
+		s.marshaling--
+		sub := scrubMarshaler(marshaler, original, fieldName, path, s)
+		if targetValue.CanAddr() {
+			if s.marshaled == nil {
+				s.marshaled = make(map[leaf]*jsonSubstitution)
+			}
+			s.marshaled[leafOf(targetValue)] = sub
+		}
+	}
+}
+
+// scrubMarshaler scrubs the output of 'marshaler' without a schema (see
+// scrubSchemaless), where 'fieldName' and 'path' are the name and the path of
+// the field holding it, and 'original' is its output before it was scrubbed.
+// The values which differ from 'original' were masked through the fields of
+// 'marshaler', and are left as they are. The output is produced only when
+// the input is formatted, so the scrubbed output is saved in 'state' to be
+// substituted for it then, at the current position in the JSON formatting of
+// the input. It returns the substitution, or nil if nothing is masked.
+func scrubMarshaler(marshaler json.Marshaler, original interface{}, fieldName,
+	path string, state *scrubState) *jsonSubstitution {
+	data, err := marshalJSON(marshaler)
+	if err != nil {
+		return nil
+	}
+
+	var find bytes.Buffer
+	if err := encodeJSON(&find, data); err != nil {
+		return nil
+	}
+
+	masked := state.masked
+	data = scrubSchemaless(markMasked(data, original), fieldName, path, state)
+	if state.masked == masked {
+		return nil
+	}
+
+	var replace bytes.Buffer
+	if err := encodeJSON(&replace, data); err != nil {
+		return nil
+	}
+
+	sub := jsonSubstitution{
+		path:    append([]jsonStep(nil), state.jsonPath...),
+		find:    find.Bytes(),
+		replace: replace.Bytes(),
+	}
+	state.substitutions = append(state.substitutions, sub)
+
+	return &sub
+}
+
+// maskedJSON is a JSON value masked before it was output by a json.Marshaler,
+// which scrubSchemaless leaves as it is.
+type maskedJSON struct {
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler, marshalling the masked value.
+func (m maskedJSON) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, m.value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// markMasked returns the JSON value 'data', decoded by decodeJSON, with the
+// values which differ from those of 'original' wrapped in maskedJSON. The
+// members of objects are matched by their keys, and the elements of arrays
+// by their indexes.
+func markMasked(data, original interface{}) interface{} {
+	switch value := data.(type) {
+	case jsonObject:
+		object, ok := original.(jsonObject)
+		if !ok {
+			break
+		}
+
+		originals := make(map[string]interface{}, len(object))
+		for _, member := range object {
+			originals[member.key] = member.value
+		}
+
+		for i, member := range value {
+			if originalValue, ok := originals[member.key]; ok {
+				value[i].value = markMasked(member.value, originalValue)
+			} else {
+				value[i].value = maskedJSON{member.value}
+			}
+		}
+
+		return value
+
+	case []interface{}:
+		array, ok := original.([]interface{})
+		if !ok || len(array) != len(value) {
+			break
+		}
+
+		for i, elem := range value {
+			value[i] = markMasked(elem, array[i])
+		}
+
+		return value
+
+	default:
+		// Scalars are comparable.
+		if data == original {
+			return data
+		}
+	}
+
+	return maskedJSON{data}
+}
+
+// jsonStep is a step towards a value in the JSON formatting of the input:
+// the member 'key' of an object, or the element 'index' of an array if it is
+// not negative. Values of struct fields which are not formatted have the
+// index hiddenIndex.
+type jsonStep struct {
+	key   string
+	index int
+}
+
+// hiddenIndex is the index of the jsonStep of struct fields which are not
+// formatted.
+const hiddenIndex = -2
+
+// jsonField is the JSON formatting of a struct field by encoding/json: as
+// the member 'name' of the object of the struct, as members of that object
+// if it is 'inline' (embedded structs), or not at all if it is 'hidden'.
+type jsonField struct {
+	name   string
+	inline bool
+	hidden bool
+}
+
+// jsonFieldsCache caches jsonFields by struct type.
+var jsonFieldsCache sync.Map
+
+// jsonFields returns the JSON formatting of the fields of 'structType'.
+func jsonFields(structType reflect.Type) []jsonField {
+	if fields, ok := jsonFieldsCache.Load(structType); ok {
+		return fields.([]jsonField)
+	}
+
+	fields := make([]jsonField, structType.NumField())
+	for i := range fields {
+		field := structType.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			fields[i].hidden = true
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		switch {
+		case name == "" && field.Anonymous && fieldType.Kind() == reflect.Struct:
+			fields[i].inline = true
+		case name == "":
+			fields[i].name = field.Name
+		default:
+			fields[i].name = name
+		}
+	}
+	jsonFieldsCache.Store(structType, fields)
+
+	return fields
+}
+
+// enterJSONField starts scrubbing the field 'field' in the JSON formatting of
+// the input, and returns whether to call leaveJSON once done.
+func (s *scrubState) enterJSONField(field jsonField) bool {
+	switch {
+	case !s.substitutes || field.inline:
+		return false
+	case field.hidden:
+		s.jsonPath = append(s.jsonPath, jsonStep{index: hiddenIndex})
+	default:
+		s.jsonPath = append(s.jsonPath, jsonStep{key: field.name, index: -1})
+	}
+
+	return true
+}
+
+// enterJSON starts scrubbing the value at 'step' in the JSON formatting of
+// the input. leaveJSON must be called once done.
+func (s *scrubState) enterJSON(step jsonStep) {
+	if s.substitutes {
+		s.jsonPath = append(s.jsonPath, step)
+	}
+}
+
+// leaveJSON ends scrubbing the value of the last enterJSON or enterJSONField.
+func (s *scrubState) leaveJSON() {
+	if s.substitutes {
+		s.jsonPath = s.jsonPath[:len(s.jsonPath)-1]
+	}
+}
+
+// hiddenJSON returns whether the value being scrubbed is not formatted.
+func (s *scrubState) hiddenJSON() bool {
+	for _, step := range s.jsonPath {
+		if step.index == hiddenIndex {
+			return true
+		}
+	}
+
+	return false
+}
+
+// substituteJSON returns the JSON document 'data', formatted by json.Encoder,
+// with the JSON values at the paths of 'substitutions' replaced, if they are
+// the values expected there. The substitutions are applied from the last
+// one. A trailing newline of 'data' is kept.
+func substituteJSON(data []byte, substitutions []jsonSubstitution) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	document, err := decodeJSON(decoder)
+	if err != nil {
+		return data
+	}
+
+	for i := len(substitutions) - 1; i >= 0; i-- {
+		document = substituteJSONValue(document, substitutions[i].path, substitutions[i])
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, document); err != nil {
+		return data
+	}
+
+	// Match the output of json.Encoder, which escapes HTML characters.
+	var out bytes.Buffer
+	json.HTMLEscape(&out, buf.Bytes())
+	if bytes.HasSuffix(data, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+// substituteJSONValue returns the JSON value 'data', decoded by decodeJSON,
+// with its value at 'path' replaced by 'sub.replace' if it is 'sub.find'.
+func substituteJSONValue(data interface{}, path []jsonStep, sub jsonSubstitution) interface{} {
+	if len(path) == 0 {
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, data); err != nil || !bytes.Equal(buf.Bytes(), sub.find) {
+			return data
+		}
+
+		return json.RawMessage(sub.replace)
+	}
+
+	switch value := data.(type) {
+	case jsonObject:
+		for i, member := range value {
+			if path[0].index < 0 && member.key == path[0].key {
+				value[i].value = substituteJSONValue(member.value, path[1:], sub)
+				break
+			}
+		}
+
+	case []interface{}:
+		if index := path[0].index; index >= 0 && index < len(value) {
+			value[index] = substituteJSONValue(value[index], path[1:], sub)
+		}
+	}
+
+	return data
+}
+
+// scrubSchemaless scrubs 'data', a JSON value decoded by decodeJSON, at any
+// level recursively and returns the scrubbed value.
+//
+// It is the counterpart of scrubInternal for data without a Go struct: the
+// keys of JSON objects take the role of the field names. The elements of a
+// JSON array are scrubbed as values of the field holding the array, just
+// like the elements of a slice. 'data' is modified in place.
+func scrubSchemaless(data interface{}, fieldName, path string, state *scrubState) interface{} {
+	if !state.enterNesting(path) {
+		return data
+	}
+	defer state.leaveNesting()
+
+	switch value := data.(type) {
+	case jsonObject:
+		scrubbed := make(jsonObject, 0, len(value))
+		for i, member := range value {
+			if !state.countMapEntry() {
+				scrubbed = append(scrubbed, value[i:]...)
+				break
+			}
+
+			state.depth++
+			state.names = append(state.names, member.key)
+			leaveKey := state.enterKey(member.key, false)
+			if state.drops(member.key) {
+				state.report(fieldPath(path, member.key), fmt.Sprint(member.value))
+			} else {
+				leave := state.enterSubtree(member.key)
+				member.value = scrubSchemaless(member.value, member.key,
+					fieldPath(path, member.key), state)
+				leave()
+				scrubbed = append(scrubbed, member)
+			}
+			leaveKey()
+			state.names = state.names[:len(state.names)-1]
+			state.depth--
+		}
+		scrubObjectKeys(scrubbed, path, state)
+
+		return scrubbed
+
+	case []interface{}:
+		for i, elem := range value {
+			value[i] = scrubSchemaless(elem, fieldName, indexPath(path, i), state)
+		}
+
+	case json.Number, bool:
+		if fieldOpts, ok := state.leafOptions(fieldName); ok &&
+			fieldOptions(fieldOpts).ScrubNonString {
+			state.report(path, fmt.Sprint(value))
+			if _, ok := value.(bool); ok {
+				return false
+			}
+
+			if fieldOptions(fieldOpts).PreserveNumberFormat {
+				return maskDigits(string(value.(json.Number)), fieldOpts, state.opts)
+			}
+
+			return json.Number("0")
+		}
+
+	case string:
+		if value == "" {
+			break
+		}
+
+		if fieldOpts, ok := state.stringOptions(fieldName, value); ok {
+			state.report(path, value)
+			return maskValue(value, fieldOpts, path, state)
+		}
+
+		if masked, ok := state.maskMatches(fieldName, value); ok {
+			state.report(path, value)
+			return masked
+		}
+	}
+
+	return data
+}
+
+// scrubObjectKeys masks the keys of the members of the JSON object 'object' at
+// 'path' which match the patterns set with WithKeyMatchers, like scrubKeys,
+// in the order of the members.
+func scrubObjectKeys(object jsonObject, path string, state *scrubState) {
+	if len(state.opts.keyMatchers) == 0 {
+		return
+	}
+
+	keys := make(map[string]bool, len(object))
+	for _, member := range object {
+		keys[member.key] = true
+	}
+
+	for i, member := range object {
+		if state.masksKey(member.key) {
+			state.masked++
+			object[i].key = state.maskedKey(member.key, fieldPath(path, member.key),
+				func(key string) bool { return keys[key] })
+			keys[object[i].key] = true
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package scrub
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Struct with a batch of raw JSON objects
+type Batch struct {
+	Name    string
+	Records []json.RawMessage
+}
+
+// TestScrubRawMessageSlice tests scrubbing the raw JSON objects of a slice.
+func TestScrubRawMessageSlice(t *testing.T) {
+	batch := &Batch{
+		Name: "users",
+		Records: []json.RawMessage{
+			json.RawMessage(`{"username":"John Doe","password":"John_Doe's_Password"}`),
+			json.RawMessage(`{"user":{"Password":"Jane_Doe's_Password","age":42.50}}`),
+			json.RawMessage(`[{"password":["p1","p2"]}]`),
+			nil,
+		},
+	}
+
+	batchScrubbed := &Batch{
+		Name: "users",
+		Records: []json.RawMessage{
+			json.RawMessage(`{"username":"John Doe","password":"********"}`),
+			json.RawMessage(`{"user":{"Password":"********","age":42.50}}`),
+			json.RawMessage(`[{"password":["********","********"]}]`),
+			nil,
+		},
+	}
+
+	validateScrub(t, batch, batchScrubbed, nil)
+
+	// The original raw JSON must be restored after scrubbing.
+	assert.Equal(t,
+		`{"username":"John Doe","password":"John_Doe's_Password"}`,
+		string(batch.Records[0]))
+}
+
+// TestScrubRawMessageNonString tests scrubbing numbers and booleans of raw JSON
+// on request.
+func TestScrubRawMessageNonString(t *testing.T) {
+	batch := &Batch{
+		Records: []json.RawMessage{
+			json.RawMessage(`{"pin":1234,"admin":true,"age":42,"ssn":987.65}`),
+		},
+	}
+
+	batchScrubbed := &Batch{
+		Records: []json.RawMessage{
+			json.RawMessage(`{"pin":0,"admin":false,"age":42,"ssn":987.65}`),
+		},
+	}
+
+	nonString := NewMask().ScrubNonString(true)
+	validateScrubFields(t, batch, batchScrubbed, map[string]FieldScrubOptioner{
+		"pin": nonString, "admin": nonString, "ssn": nil,
+	})
+}
+
+// TestScrubJSON tests scrubbing JSON documents without a Go struct.
+func TestScrubJSON(t *testing.T) {
+	raw := []byte(`{"username": "John Doe", "password": "hunter2", "z": 1,` +
+		` "a": {"token": "<abc>", "n": 1.50}, "list": [{"password": "p1"}, null, true]}`)
+
+	got, err := ScrubJSON(raw, map[string]FieldScrubOptioner{"password": nil, "token": nil})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"username":"John Doe","password":"********","z":1,`+
+		`"a":{"token":"********","n":1.50},"list":[{"password":"********"},null,true]}`,
+		string(got))
+
+	// Scalars and HTML characters are kept as they are.
+	got, err = ScrubJSON([]byte(`"<a & b>"`), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `"<a & b>"`, string(got))
+
+	// Invalid documents are rejected.
+	for _, raw := range []string{``, `{"a":`, `{"a":1} {}`, `{"a":1]`} {
+		_, err = ScrubJSON([]byte(raw), nil)
+		assert.ErrorIs(t, err, ErrInvalidInput, raw)
+	}
+
+	// Errors stopping the scrubbing are returned in strict mode.
+	_, err = ScrubJSON([]byte(`{"a":1,"b":2}`), nil, WithMaxMapEntries(1), WithStrict(true))
+	assert.ErrorIs(t, err, ErrTooManyMapEntries)
+}
+
+// Struct with a raw JSON field
+type Webhook struct {
+	URL     string
+	Payload json.RawMessage
+}
+
+// TestScrubRawMessageField tests scrubbing secrets nested deep in a raw JSON
+// field.
+func TestScrubRawMessageField(t *testing.T) {
+	payload := `{"event":"login","data":{"user":{"name":"john","password":"hunter2"}}}`
+	hook := &Webhook{URL: "https://example.com/hook", Payload: json.RawMessage(payload)}
+
+	hookScrubbed := &Webhook{
+		URL:     "https://example.com/hook",
+		Payload: json.RawMessage(`{"event":"login","data":{"user":{"name":"john","password":"********"}}}`),
+	}
+
+	validateScrub(t, hook, hookScrubbed, nil)
+
+	// The original raw JSON must be restored after scrubbing.
+	assert.Equal(t, payload, string(hook.Payload))
+}
+
+// TestScrubRawMessageUnchanged tests that raw JSON with nothing to scrub is
+// left as it was written.
+func TestScrubRawMessageUnchanged(t *testing.T) {
+	payload := `{ "z": 1, "html": "<a href=\"x\">&amp;</a>", "a": [ 1.50 ] }`
+	hook := &Webhook{Payload: json.RawMessage(payload)}
+
+	assert.NoError(t, ScrubStruct(hook, nil))
+	assert.Equal(t, payload, string(hook.Payload))
+
+	// Scrubbed raw JSON keeps its order and HTML characters.
+	hook.Payload = json.RawMessage(`{"z":1,"html":"<b>","password":"hunter2"}`)
+	paths, err := ScrubReport(hook, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Payload.password"}, paths)
+
+	hook.Payload = json.RawMessage(`{"z":1,"html":"<b>","password":"hunter2"}`)
+	assert.NoError(t, ScrubStruct(hook, nil))
+	assert.Equal(t, `{"z":1,"html":"<b>","password":"********"}`, string(hook.Payload))
+}
+
+// TestScrubJSONNesting tests the nesting limit and the cancellation of
+// scrubbing JSON without a schema.
+func TestScrubJSONNesting(t *testing.T) {
+	deep := strings.Repeat(`{"a":`, 50) + `{"password":"hunter2"}` + strings.Repeat("}", 50)
+
+	raw, err := ScrubJSON([]byte(deep), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "hunter2")
+
+	// Deeper values are left as is, unless in strict mode.
+	raw, err = ScrubJSON([]byte(deep), nil, WithMaxNesting(20))
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "hunter2")
+
+	_, err = ScrubJSON([]byte(deep), nil, WithMaxNesting(20), WithStrict(true))
+	assert.ErrorIs(t, err, ErrTooDeep)
+
+	batch := &Batch{Records: []json.RawMessage{json.RawMessage(deep)}}
+	_, err = ScrubWithOptions(batch, nil, JSONScrub, WithMaxNesting(20), WithStrict(true))
+	assert.ErrorIs(t, err, ErrTooDeep)
+
+	// Cancelled contexts stop scrubbing raw JSON too.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	state := newScrubState(nil, nil)
+	state.ctx = ctx
+	scrubSchemaless(map[string]interface{}{"password": "hunter2"}, "", "", state)
+	assert.ErrorIs(t, state.err, context.Canceled)
+}
+
+// Passport marshalled to JSON by its own method, which its fields don't
+// show
+type Passport struct {
+	user   string
+	secret string
+}
+
+// MarshalJSON marshals the passport as a JSON object.
+func (c Passport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"username": c.user, "password": c.secret})
+}
+
+// Struct with a field marshalled by its own method
+type Endpoint struct {
+	Host     string
+	Passport Passport
+	Backup   *Passport
+	Note     string
+}
+
+// TestScrubMarshaler tests scrubbing the output of MarshalJSON methods.
+func TestScrubMarshaler(t *testing.T) {
+	conn := &Endpoint{
+		Host:     "db.example.com",
+		Passport: Passport{user: "admin", secret: "x"},
+		Backup:   &Passport{user: "backup", secret: "hunter2"},
+		Note:     `{"password":"x","username":"admin"}`,
+	}
+
+	got := Scrub(conn, map[string]bool{"password": true})
+	assert.Equal(t, `{"Host":"db.example.com",`+
+		`"Passport":{"password":"********","username":"admin"},`+
+		`"Backup":{"password":"********","username":"backup"},`+
+		`"Note":"{\"password\":\"x\",\"username\":\"admin\"}"}`, got)
+	assert.Equal(t, "x", conn.Passport.secret)
+
+	var buf strings.Builder
+	err := ScrubTo(&buf, conn, map[string]FieldScrubOptioner{"password": nil})
+	assert.Nil(t, err)
+	assert.Equal(t, got+"\n", buf.String())
+
+	// The output is left as is if nothing in it is masked.
+	got = Scrub(conn, map[string]bool{"token": true})
+	assert.Equal(t, `{"Host":"db.example.com",`+
+		`"Passport":{"password":"x","username":"admin"},`+
+		`"Backup":{"password":"hunter2","username":"backup"},`+
+		`"Note":"{\"password\":\"x\",\"username\":\"admin\"}"}`, got)
+
+	// The input itself may marshal to JSON by its own method.
+	got = Scrub(&Passport{user: "admin", secret: "x"}, map[string]bool{"password": true})
+	assert.Equal(t, `{"password":"********","username":"admin"}`, got)
+
+	paths, err := ScrubReport(conn, map[string]FieldScrubOptioner{"password": nil})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Backup.password", "Passport.password"}, paths)
+}
+
+// Struct with a field marshalled by its own method, and another with the
+// same output
+type Mirror struct {
+	Passport Passport
+	Copy     struct {
+		Password string `json:"password"`
+		Username string `json:"username"`
+	}
+	Hidden Passport `json:"-"`
+}
+
+// TestScrubMarshalerPosition tests that the scrubbed output of a MarshalJSON
+// method is substituted at its own position only.
+func TestScrubMarshalerPosition(t *testing.T) {
+	mirror := &Mirror{Passport: Passport{user: "admin", secret: "x"}}
+	mirror.Copy.Password, mirror.Copy.Username = "x", "admin"
+	mirror.Hidden = mirror.Passport
+
+	got := Scrub(mirror, map[string]bool{"passport.password": true})
+	assert.Equal(t, `{"Passport":{"password":"********","username":"admin"},`+
+		`"Copy":{"password":"x","username":"admin"}}`, got)
+
+	paths, err := ScrubReport(mirror, map[string]FieldScrubOptioner{"password": nil})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Copy.Password", "Passport.password"}, paths)
+
+	// The same output in a slice is substituted at each position.
+	list := &[]interface{}{mirror.Passport, mirror.Copy, &mirror.Passport}
+	got = Scrub(list, map[string]bool{"passport.password": true, "password": true})
+	assert.Equal(t, `[{"password":"********","username":"admin"},`+
+		`{"password":"********","username":"admin"},`+
+		`{"password":"********","username":"admin"}]`, got)
+}
+
+// Bearer marshalled to JSON by its own method, through an alias of its type
+type Bearer struct {
+	Token string `json:"token"`
+	Note  string `json:"note"`
+}
+
+// MarshalJSON marshals the bearer without its methods.
+func (b Bearer) MarshalJSON() ([]byte, error) {
+	type alias Bearer
+	return json.Marshal(alias(b))
+}
+
+// Struct with several references to a bearer
+type Bearers struct {
+	Current *Bearer
+	Last    *Bearer
+}
+
+// TestScrubMarshalerAlias tests that values masked through the fields of a
+// type marshalled by its own method are not masked again in its output.
+func TestScrubMarshalerAlias(t *testing.T) {
+	jwt := "eyJhbGciOi.eyJzdWIiOi.SflKxwRJSM"
+	bearer := &Bearer{Token: jwt, Note: "password: hunter2"}
+
+	got := ScrubFields(bearer, map[string]FieldScrubOptioner{
+		"token": NewMask().Strategy(JWTSignatureMask),
+	})
+	assert.Equal(t, `{"token":"eyJhbGciOi.eyJzdWIiOi.********","note":"password: hunter2"}`, got)
+
+	suffix, _ := DigestSuffixMask(jwt)
+	bearers := &Bearers{Current: bearer, Last: bearer}
+	got = ScrubFields(bearers, map[string]FieldScrubOptioner{
+		"token": NewMask().Strategy(DigestSuffixMask),
+	})
+	want := `{"token":"` + suffix + `","note":"password: hunter2"}`
+	assert.Equal(t, `{"Current":`+want+`,"Last":`+want+`}`, got)
+	assert.Equal(t, jwt, bearer.Token)
+
+	// Values of the output which were not masked through the fields are
+	// still scrubbed.
+	got = ScrubFields(bearers, map[string]FieldScrubOptioner{
+		"token": NewMask().Strategy(DigestSuffixMask),
+		"note":  nil,
+	})
+	want = `{"token":"` + suffix + `","note":"********"}`
+	assert.Equal(t, `{"Current":`+want+`,"Last":`+want+`}`, got)
+}
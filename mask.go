@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import "time"
+
+// Mask builds the scrubbing options of fields fluently, e.g.
+// NewMask().Strategy(JWTSignatureMask), and implements FieldScrubOptioner.
+// Its methods return a modified copy of the Mask, so a Mask can be built once
+// and reused for many fields, or as the base of other Masks.
+type Mask struct {
+	opts FieldScrubOptions
+}
+
+// NewMask returns a Mask with the default options, i.e. masking fully.
+func NewMask() *Mask {
+	return &Mask{}
+}
+
+// Token returns a copy of the Mask which replaces values by 'token'.
+// See FieldScrubOptions.Token.
+func (m *Mask) Token(token string) *Mask {
+	c := *m
+	c.opts.Token = token
+	return &c
+}
+
+// Strategy returns a copy of the Mask which masks values with 'strategy'.
+// See FieldScrubOptions.Strategy.
+func (m *Mask) Strategy(strategy Strategy) *Mask {
+	c := *m
+	c.opts.Strategy = strategy
+	c.opts.keyedStrategy = nil
+	return &c
+}
+
+// Symbol returns a copy of the Mask which masks values with 'symbol', e.g.
+// "#". See FieldScrubOptions.Symbol.
+func (m *Mask) Symbol(symbol string) *Mask {
+	c := *m
+	c.opts.Symbol = symbol
+	return &c
+}
+
+// Partial returns a copy of the Mask which keeps the first 'front' and the
+// last 'back' characters of values visible. See FieldScrubOptions.ShowFirst.
+func (m *Mask) Partial(front, back int) *Mask {
+	c := *m
+	c.opts.ShowFirst, c.opts.ShowLast = front, back
+	return &c
+}
+
+// KeyByPath returns a copy of the Mask which keys the digests of Hash with the
+// paths of fields if 'keyByPath' is set. See FieldScrubOptions.KeyByPath.
+func (m *Mask) KeyByPath(keyByPath bool) *Mask {
+	c := *m
+	c.opts.KeyByPath = keyByPath
+	return &c
+}
+
+// Pipeline returns a copy of the Mask which masks values with the 'steps'
+// applied in order. See Pipeline.
+func (m *Mask) Pipeline(steps ...Transform) *Mask {
+	return m.Strategy(Pipeline(steps...))
+}
+
+// Hash returns a copy of the Mask which replaces values by their salted
+// SHA-256 digest. See HashMask. With KeyByPath, the digest is keyed with
+// the salt followed by a NUL byte and the path of the field.
+func (m *Mask) Hash(salt []byte, hexLen int) *Mask {
+	c := m.Strategy(HashMask(salt, hexLen))
+	c.opts.keyedStrategy = func(path string) Strategy {
+		key := make([]byte, 0, len(salt)+1+len(path))
+		key = append(append(append(key, salt...), 0), path...)
+		return HashMask(key, hexLen)
+	}
+	return c
+}
+
+// MaskSubtree returns a copy of the Mask which masks every leaf beneath fields
+// if 'maskSubtree' is set. See FieldScrubOptions.MaskSubtree.
+func (m *Mask) MaskSubtree(maskSubtree bool) *Mask {
+	c := *m
+	c.opts.MaskSubtree = maskSubtree
+	return &c
+}
+
+// ScrubNonString returns a copy of the Mask which also scrubs numbers and
+// booleans if 'scrubNonString' is set. See FieldScrubOptions.ScrubNonString.
+func (m *Mask) ScrubNonString(scrubNonString bool) *Mask {
+	c := *m
+	c.opts.ScrubNonString = scrubNonString
+	return &c
+}
+
+// PreserveNumberFormat returns a copy of the Mask which masks the digits of
+// numbers, keeping their format, where they can be replaced by a string, if
+// 'preserve' is set. See FieldScrubOptions.PreserveNumberFormat.
+func (m *Mask) PreserveNumberFormat(preserve bool) *Mask {
+	c := *m
+	c.opts.PreserveNumberFormat = preserve
+	return &c
+}
+
+// MaskInEnvs returns a copy of the Mask which masks fields only in the
+// environments 'envs'. See FieldScrubOptions.MaskInEnvs.
+func (m *Mask) MaskInEnvs(envs ...string) *Mask {
+	c := *m
+	c.opts.MaskInEnvs = envs
+	return &c
+}
+
+// RevealInEnvs returns a copy of the Mask which reveals fields in the
+// environments 'envs'. See FieldScrubOptions.RevealInEnvs.
+func (m *Mask) RevealInEnvs(envs ...string) *Mask {
+	c := *m
+	c.opts.RevealInEnvs = envs
+	return &c
+}
+
+// When returns a copy of the Mask which scrubs fields only if 'when' returns
+// true for their siblings. See FieldScrubOptions.When.
+func (m *Mask) When(when func(siblings map[string]string) bool) *Mask {
+	c := *m
+	c.opts.When = when
+	return &c
+}
+
+// Drop returns a copy of the Mask which removes fields rather than masking
+// them if 'drop' is set. See FieldScrubOptions.Drop.
+func (m *Mask) Drop(drop bool) *Mask {
+	c := *m
+	c.opts.Drop = drop
+	return &c
+}
+
+// Truncate returns a copy of the Mask which truncates times to a multiple of
+// 'd'. See FieldScrubOptions.Truncate.
+func (m *Mask) Truncate(d time.Duration) *Mask {
+	c := *m
+	c.opts.Truncate = d
+	return &c
+}
+
+// ScrubOptions returns the options built by the Mask. They must not be modified.
+func (m *Mask) ScrubOptions() *FieldScrubOptions {
+	return &m.opts
+}
@@ -0,0 +1,65 @@
+package scrub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMask tests scrubbing with options built by a Mask.
+func TestMask(t *testing.T) {
+	jwt := NewMask().Strategy(JWTSignatureMask)
+	token := jwt.Token("<token>")
+
+	// Building 'token' must not modify 'jwt'.
+	assert.Equal(t, "", jwt.ScrubOptions().Token)
+
+	session := &Session{User: "John Doe", Token: "aGVhZGVy.cGF5bG9hZA.c2ln"}
+	users := &Users{
+		Secret: "secret_sshhh",
+		Keys:   []string{"key_1"},
+		UserInfo: []User{
+			{Username: "John Doe", Password: "John_Doe's_Password"},
+		},
+	}
+
+	fields := map[string]FieldScrubOptioner{
+		"token":    jwt,
+		"secret":   jwt,
+		"keys":     token,
+		"password": NewMask(),
+	}
+
+	validateScrubFields(t, session,
+		&Session{User: "John Doe", Token: "aGVhZGVy.cGF5bG9hZA.********"}, fields)
+
+	validateScrubFields(t, users, &Users{
+		Secret: "********",
+		Keys:   []string{"<token>"},
+		UserInfo: []User{
+			{Username: "John Doe", Password: "********"},
+		},
+	}, fields)
+}
+
+// TestMaskPartialSymbol tests masking fields partially, with their own symbol.
+func TestMaskPartialSymbol(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	hash := NewMask().Symbol("#")
+	fields := map[string]FieldScrubOptioner{
+		"username": hash,
+		"password": hash.Partial(2, 1),
+	}
+
+	// The options of the fields take precedence over those of the call, which
+	// apply otherwise.
+	got := ScrubFields(user, fields, WithAlwaysShowFirst(3), WithDefaultSymbol("•"))
+	assert.Equal(t, `{"Username":"Joh########","Password":"Jo########d","DbSecrets":null}`, got)
+
+	got = ScrubFields(user, fields, WithMaskLenVary(true))
+	assert.Equal(t, `{"Username":"########","Password":"Jo################d","DbSecrets":null}`, got)
+
+	// Short values are masked fully.
+	got = ScrubFields(user, map[string]FieldScrubOptioner{"username": NewMask().Partial(4, 4)})
+	assert.Equal(t, `{"Username":"********","Password":"John_Doe's_Password","DbSecrets":null}`, got)
+}
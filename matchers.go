@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CreditCardPattern matches credit card numbers of 13 to 19 digits, which
+// may be separated by spaces or dashes, for use with WithValueMatchers.
+var CreditCardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// EmailPattern matches email addresses, for use with WithValueMatchers.
+var EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// maskMatches returns the string 'value' named 'fieldName' with the matches
+// of the patterns set with WithValueMatchers masked, or false if nothing in
+// it matched.
+func (s *scrubState) maskMatches(fieldName, value string) (string, bool) {
+	if len(s.opts.valueMatchers) == 0 || s.opts.excludedFields[s.fold(fieldName)] {
+		return value, false
+	}
+
+	masked := value
+	for _, pattern := range s.opts.valueMatchers {
+		if pattern == nil {
+			continue
+		}
+
+		masked = pattern.ReplaceAllStringFunc(masked, func(match string) string {
+			return s.opts.mask(s.opts.maskSymbol, utf8.RuneCountInString(match))
+		})
+	}
+
+	return masked, masked != value
+}
+
+// scrubMatches masks the matches of the patterns set with WithValueMatchers
+// in the string 'targetValue' named 'fieldName' at 'path', and saves a
+// function to restore its original value in 'state'.
+func scrubMatches(targetValue reflect.Value, fieldName, path string, state *scrubState) {
+	if !targetValue.CanSet() {
+		return
+	}
+
+	original := targetValue.String()
+	masked, ok := state.maskMatches(fieldName, original)
+	if !ok {
+		return
+	}
+
+	state.saveRestoreFunc(func() { targetValue.SetString(original) })
+	state.report(path, original)
+
+	targetValue.SetString(masked)
+}
+
+// masksKey returns true if the map key 'key' matches one of the patterns set
+// with WithKeyMatchers.
+func (s *scrubState) masksKey(key string) bool {
+	for _, pattern := range s.opts.keyMatchers {
+		if pattern != nil && pattern.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskedKey returns the map key 'key' at 'path' masked with the default
+// options, followed by "#2", "#3", etc. until the result is not 'taken'.
+func (s *scrubState) maskedKey(key, path string, taken func(string) bool) string {
+	masked := maskValue(key, nil, path, s)
+	candidate := masked
+	for n := 2; taken(candidate); n++ {
+		candidate = masked + "#" + strconv.Itoa(n)
+	}
+
+	return candidate
+}
+
+// scrubKeys moves the entries of the map 'targetValue' at 'path' whose keys
+// match the patterns set with WithKeyMatchers under their masked keys, and
+// saves functions to move them back in 'state'. Keys are masked in sorted
+// order, so that colliding masks are told apart the same way every time.
+func scrubKeys(targetValue reflect.Value, path string, state *scrubState) {
+	if len(state.opts.keyMatchers) == 0 {
+		return
+	}
+
+	var keys []reflect.Value
+	matched := make(map[string]bool)
+	iter := targetValue.MapRange()
+	for iter.Next() {
+		if key := iter.Key(); state.masksKey(key.String()) {
+			keys = append(keys, key)
+			matched[key.String()] = true
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	keyType := targetValue.Type().Key()
+	taken := func(key string) bool {
+		return matched[key] || targetValue.MapIndex(reflect.ValueOf(key).Convert(keyType)).IsValid()
+	}
+
+	for _, key := range keys {
+		key, value := key, targetValue.MapIndex(key)
+		maskedKey := reflect.ValueOf(state.maskedKey(key.String(),
+			fieldPath(path, key.String()), taken)).Convert(keyType)
+
+		targetValue.SetMapIndex(key, reflect.Value{})
+		targetValue.SetMapIndex(maskedKey, value)
+		state.saveRestoreFunc(func() {
+			targetValue.SetMapIndex(maskedKey, reflect.Value{})
+			targetValue.SetMapIndex(key, value)
+		})
+	}
+}
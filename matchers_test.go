@@ -0,0 +1,128 @@
+package scrub
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Struct with free-text fields
+type Ticket struct {
+	ID          string
+	Description string
+	Notes       []string
+}
+
+// TestScrubValueMatchers tests masking secrets found by pattern in any string.
+func TestScrubValueMatchers(t *testing.T) {
+	ticket := &Ticket{
+		ID:          "T-1",
+		Description: "card 4111 1111 1111 1111 declined for john.doe@example.com",
+		Notes: []string{
+			"retry with 5500-0000-0000-0004",
+			"my password is hunter2",
+			"call 555-1234",
+		},
+	}
+
+	ticketScrubbed := &Ticket{
+		ID:          "T-1",
+		Description: "card ******** declined for ********",
+		Notes: []string{
+			"retry with ********",
+			"my password is ********",
+			"call 555-1234",
+		},
+	}
+
+	want, _ := json.Marshal(ticketScrubbed)
+	got := Scrub(ticket, map[string]bool{}, WithValueMatchers(CreditCardPattern, EmailPattern),
+		WithValueMatchers(regexp.MustCompile(`hunter\d`)))
+	assert.Equal(t, string(want), got)
+
+	// Matches are masked as values are.
+	ticketScrubbed = &Ticket{
+		ID:          "T-1",
+		Description: "card ################### declined for ####################",
+		Notes: []string{
+			"retry with ###################",
+			"my password is #######",
+			"call 555-1234",
+		},
+	}
+
+	validateScrub(t, ticket, ticketScrubbed, map[string]bool{},
+		WithValueMatchers(CreditCardPattern, EmailPattern),
+		WithValueMatchers(regexp.MustCompile(`hunter\d`)), WithMaskLenVary(true),
+		WithDefaultSymbol("#"))
+
+	// Fields scrubbed by name are masked fully, and excluded fields are not scrubbed.
+	got = Scrub(ticket, map[string]bool{"description": true}, WithValueMatchers(CreditCardPattern),
+		WithExcludedFields("notes"))
+	assert.Contains(t, got, `"Description":"********"`)
+	assert.Contains(t, got, "5500-0000-0000-0004")
+}
+
+// TestPatterns tests the patterns provided for WithValueMatchers.
+func TestPatterns(t *testing.T) {
+	for _, value := range []string{"4111111111111111", "4111 1111 1111 1111", "3782-822463-10005"} {
+		assert.True(t, CreditCardPattern.MatchString(value), "value %q", value)
+	}
+
+	for _, value := range []string{"555-1234", "12345678", "order 20220405"} {
+		assert.False(t, CreditCardPattern.MatchString(value), "value %q", value)
+	}
+
+	assert.Equal(t, "jane+ops@mail.example.org",
+		EmailPattern.FindString("mail jane+ops@mail.example.org now"))
+	assert.False(t, EmailPattern.MatchString("user@localhost"))
+}
+
+// TestScrubKeyMatchers tests masking the keys of maps matching patterns.
+func TestScrubKeyMatchers(t *testing.T) {
+	accounts := map[string]interface{}{
+		"john@example.com": map[string]interface{}{"role": "admin", "password": "hunter2"},
+		"jane@example.com": map[string]interface{}{"role": "user"},
+		"total":            2,
+	}
+
+	got := Scrub(&accounts, nil, WithKeyMatchers(EmailPattern))
+	assert.Equal(t, `{"********":{"role":"user"},"********#2":{"password":"********","role":"admin"},`+
+		`"total":2}`, got)
+
+	// The original keys and values must be restored after scrubbing.
+	assert.Len(t, accounts, 3)
+	assert.Equal(t, map[string]interface{}{"role": "admin", "password": "hunter2"},
+		accounts["john@example.com"])
+
+	// Values are scrubbed by their original keys, and masks don't collide
+	// with the other keys.
+	secrets := map[string]string{"password": "hunter2", "********": "x", "key_12": "y"}
+	got = Scrub(&secrets, nil, WithKeyMatchers(regexp.MustCompile(`^(password|key_)`)),
+		WithAlwaysShowFirst(3))
+	assert.Equal(t, `{"********":"x","********#2":"y","pas********":"hun********"}`, got)
+	assert.Equal(t, "hunter2", secrets["password"])
+	assert.Equal(t, "y", secrets["key_12"])
+
+	// Keys of raw JSON objects keep their order.
+	raw, err := ScrubJSON([]byte(`{"z":1,"jane@example.com":2,"a":{"john@example.com":3}}`), nil,
+		WithKeyMatchers(EmailPattern))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"z":1,"********":2,"a":{"********":3}}`, string(raw))
+}
+
+// TestNilMatchers tests that nil patterns are ignored, and reported by
+// Scrubber.Validate.
+func TestNilMatchers(t *testing.T) {
+	ticket := &Ticket{ID: "T-1", Description: "mail john@example.com"}
+	opts := []Option{WithValueMatchers(nil, EmailPattern), WithKeyMatchers(nil)}
+
+	got := Scrub(ticket, map[string]bool{}, opts...)
+	assert.Equal(t, `{"ID":"T-1","Description":"mail ********","Notes":null}`, got)
+
+	err := NewScrubber(nil, opts...).Validate()
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.EqualError(t, err, "scrub: invalid config: nil value pattern; nil key pattern")
+}
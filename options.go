@@ -0,0 +1,460 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Option configures a single scrubbing call.
+type Option func(*options)
+
+// options holds the configuration of a scrubbing call, as set by its Options.
+type options struct {
+	// Field names (case folded, see fold) not to scrub, even if specified
+	// otherwise.
+	excludedFields map[string]bool
+
+	// Number of leading and trailing characters of scrubbed values to keep
+	// visible.
+	alwaysShowFirst int
+	alwaysShowLast  int
+
+	// Maximum number of map entries to scrub, or 0 for no limit.
+	maxMapEntries int
+
+	// Maximum nesting level of the values to scrub.
+	maxNesting int
+
+	// Whether to fail on problems which are otherwise tolerated.
+	strict bool
+
+	// Format of the scrubbed output.
+	dataType DataType
+
+	// Field name (case folded, see fold) and value marking the structs to
+	// redact fully, if the name is set.
+	sentinelField string
+	sentinelValue interface{}
+
+	// Minimum entropy, in bits per character, and length of the strings
+	// scrubbed whatever their names, if the entropy is positive.
+	minEntropy       float64
+	minEntropyLength int
+	// Patterns of the secrets to mask in any string.
+	valueMatchers []*regexp.Regexp
+	// Patterns of the map keys to mask.
+	keyMatchers []*regexp.Regexp
+
+	// Depth of the fields to scrub, or -1 for any depth.
+	depth int
+
+	// Whether masks have the length of the masked values, the length of
+	// the other masks, and the symbol they are made of, '*' if empty.
+	maskLenVary bool
+	maskLen     int
+	maskSymbol  string
+
+	// Whether field names are compared case sensitively.
+	caseSensitive bool
+
+	// Fields to scrub if none are given, DefaultToScrub if nil.
+	defaultFields map[string]FieldScrubOptioner
+
+	// Function called when a value is masked fully instead of partially.
+	onPartialFallback func(path string, valueLen int)
+
+	// Whether values masked fully instead of partially get a fixed-length
+	// mask, even with maskLenVary.
+	fixedLenFallback bool
+
+	// Current environment, for FieldScrubOptions.MaskInEnvs and RevealInEnvs.
+	environment string
+
+	// Interfaces whose implementations are masked whatever their names.
+	secretInterfaces []reflect.Type
+
+	// Prefixes and suffixes of the field names to scrub, in the order they
+	// were given.
+	nameMatchers []nameMatcher
+}
+
+// nameMatcher scrubs the fields whose names start or end with 'affix' (case
+// folded, see fold) with the options 'fieldOpts'.
+type nameMatcher struct {
+	affix     string
+	prefix    bool
+	fieldOpts FieldScrubOptioner
+}
+
+// matches returns true if the field name 'name' (case folded) matches 'm'.
+func (m nameMatcher) matches(name string) bool {
+	if m.prefix {
+		return strings.HasPrefix(name, m.affix)
+	}
+
+	return strings.HasSuffix(name, m.affix)
+}
+
+// newOptions returns the configuration set by the given Options.
+func newOptions(opts []Option) *options {
+	o := &options{depth: -1, maskLen: len(defaultMask), maxNesting: defaultMaxNesting}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// Fold the field names once all the options are known.
+	excludedFields := make(map[string]bool, len(o.excludedFields))
+	for name := range o.excludedFields {
+		excludedFields[o.fold(name)] = true
+	}
+	o.excludedFields = excludedFields
+	o.sentinelField = o.fold(o.sentinelField)
+	for i := range o.nameMatchers {
+		o.nameMatchers[i].affix = o.fold(o.nameMatchers[i].affix)
+	}
+
+	return o
+}
+
+// fold returns the form of the field name 'name' to compare field names
+// with: its case folded form, unless field names are case sensitive.
+func (o *options) fold(name string) string {
+	if o.caseSensitive {
+		return name
+	}
+
+	return foldName(name)
+}
+
+// reportFallback reports that the value at 'path' of 'valueLen' characters
+// is masked fully instead of partially, see WithPartialFallback.
+func (o *options) reportFallback(path string, valueLen int) {
+	if o.onPartialFallback != nil {
+		o.onPartialFallback(path, valueLen)
+	}
+}
+
+// masksIn returns true if the field with the options 'fieldOpts' is masked in
+// the current environment, see FieldScrubOptions.MaskInEnvs and RevealInEnvs.
+func (o *options) masksIn(fieldOpts FieldScrubOptioner) bool {
+	fo := fieldOptions(fieldOpts)
+	if len(fo.MaskInEnvs) > 0 && !containsString(fo.MaskInEnvs, o.environment) {
+		return false
+	}
+
+	return !containsString(fo.RevealInEnvs, o.environment)
+}
+
+// containsString returns true if 'values' contains 'value'.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fallbackMask returns the mask made of 'symbol' of a value of 'length'
+// characters masked fully instead of partially, see WithFixedLenFallback.
+func (o *options) fallbackMask(symbol string, length int) string {
+	if o.fixedLenFallback {
+		length = o.fixedMaskLen()
+	}
+
+	return o.mask(symbol, length)
+}
+
+// mask returns the mask made of 'symbol' ('*' if empty) of a value of
+// 'length' characters.
+func (o *options) mask(symbol string, length int) string {
+	if !o.maskLenVary {
+		length = o.fixedMaskLen()
+	}
+
+	return MaskFull(symbol, length)
+}
+
+// fixedMaskLen returns the length of the masks which don't have the length of
+// the masked values, see WithMaskLen.
+func (o *options) fixedMaskLen() int {
+	if o.maskLen <= 0 {
+		return len(defaultMask)
+	}
+
+	return o.maskLen
+}
+
+// WithExcludedFields excludes the given field names from the effective fields
+// to scrub of a call, whether they come from DefaultToScrub, FieldGroups or
+// the given fields. For example, a password-reset flow can log a token which
+// is scrubbed everywhere else. Comparison is case insensitive, unless set
+// otherwise with WithCaseSensitiveFields.
+func WithExcludedFields(names ...string) Option {
+	return func(o *options) {
+		if o.excludedFields == nil {
+			o.excludedFields = make(map[string]bool, len(names))
+		}
+
+		for _, name := range names {
+			o.excludedFields[name] = true
+		}
+	}
+}
+
+// WithAlwaysShowFirst keeps the first 'n' characters of scrubbed values
+// visible, followed by the mask, so that log readers can correlate values.
+// Values of at most 2*n characters are masked fully, as showing their first
+// characters would reveal too much of them. Fields with a masking token are
+// always replaced by their token.
+func WithAlwaysShowFirst(n int) Option {
+	return func(o *options) {
+		o.alwaysShowFirst = n
+	}
+}
+
+// WithAlwaysShowLast keeps the last 'n' characters of scrubbed values
+// visible, after the mask, as commonly done to display card or phone numbers,
+// e.g. "********5678". It can be combined with WithAlwaysShowFirst: values of
+// at most twice as many characters as are visible in total are masked fully.
+// Fields with a masking token are always replaced by their token.
+func WithAlwaysShowLast(n int) Option {
+	return func(o *options) {
+		o.alwaysShowLast = n
+	}
+}
+
+// WithMaxMapEntries limits the total number of map entries scrubbed in a call
+// to 'max', to bound the work on inputs with huge maps. Entries beyond the
+// limit are left as is, i.e. NOT scrubbed, unless strict mode is enabled
+// (see WithStrict), in which case the call fails with ErrTooManyMapEntries.
+// A limit of 0 (the default) means no limit.
+func WithMaxMapEntries(max int) Option {
+	return func(o *options) {
+		o.maxMapEntries = max
+	}
+}
+
+// WithMaxNesting limits the nesting level of the values scrubbed to 'max',
+// so that absurdly deep values don't overflow the stack. Each struct field,
+// map entry, slice element, pointer and interface counts as a level. Values
+// nested deeper are left as is, i.e. NOT scrubbed, unless strict mode is
+// enabled (see WithStrict), in which case the call fails with ErrTooDeep.
+// The default limit is 256. Values referring to themselves through pointers
+// or maps, such as a struct pointing to itself, are scrubbed once whatever
+// the limit.
+func WithMaxNesting(max int) Option {
+	return func(o *options) {
+		o.maxNesting = max
+	}
+}
+
+// WithStrict enables strict mode, in which problems that are otherwise
+// tolerated stop the scrubbing with an error instead, so that nothing which
+// might be partially scrubbed is returned. Functions which don't return an
+// error, like Scrub, return an empty string then.
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.strict = strict
+	}
+}
+
+// WithDataType sets the format of the string returned for the scrubbed value,
+// JSONScrub by default. Nil inputs are formatted as a null value of the data
+// type, e.g. "null\n" for YAMLScrub.
+func WithDataType(dataType DataType) Option {
+	return func(o *options) {
+		o.dataType = dataType
+	}
+}
+
+// WithSentinelField redacts whole records: every leaf value of a struct
+// having a field named 'name' (case insensitive) equal to 'value', such as a
+// "Confidential" field set to true, is masked with the default options,
+// whether or not it is to be scrubbed itself, like a field scrubbed with
+// FieldScrubOptions.MaskSubtree. 'value' must have the type of the field to
+// be equal to it.
+func WithSentinelField(name string, value interface{}) Option {
+	return func(o *options) {
+		o.sentinelField = name
+		o.sentinelValue = value
+	}
+}
+
+// WithEntropyDetection scrubs the strings which look like secrets, such as
+// API keys or tokens, whatever the names of their fields, to catch secrets
+// missed by the fields to scrub: a string is scrubbed with the default
+// options if its Shannon entropy is above 'threshold' bits per character
+// and it has at least 'minLength' characters. For example, a threshold of
+// 4 with a minimum length of 20 catches random base64 tokens, while leaving
+// most words and sentences as is. Excluded fields are never scrubbed.
+func WithEntropyDetection(threshold float64, minLength int) Option {
+	return func(o *options) {
+		o.minEntropy = threshold
+		o.minEntropyLength = minLength
+	}
+}
+
+// WithValueMatchers masks the matches of 'patterns', such as
+// CreditCardPattern or EmailPattern, in any string which is not scrubbed as
+// a whole, whatever the name of its field, to catch secrets embedded in free
+// text such as "card 4111 1111 1111 1111 declined". Each match is masked
+// fully, like a value: with the symbol set with WithDefaultSymbol, and as
+// many symbols as it has characters with WithMaskLenVary only. Excluded
+// fields are never scrubbed. Nil patterns are ignored, and reported by
+// Scrubber.Validate.
+func WithValueMatchers(patterns ...*regexp.Regexp) Option {
+	return func(o *options) {
+		o.valueMatchers = append(o.valueMatchers, patterns...)
+	}
+}
+
+// WithKeyMatchers masks the keys of maps matching one of 'patterns', e.g.
+// EmailPattern for maps keyed by email addresses, in addition to their values
+// as usual: the values are still scrubbed by their original keys. Keys are
+// masked with the default options; masked keys which collide with another
+// key get a "#2", "#3", etc. suffix, in the order of the original keys. The
+// keys of raw JSON objects are masked too. Nil patterns are ignored, and
+// reported by Scrubber.Validate.
+func WithKeyMatchers(patterns ...*regexp.Regexp) Option {
+	return func(o *options) {
+		o.keyMatchers = append(o.keyMatchers, patterns...)
+	}
+}
+
+// WithDepth scrubs the fields to scrub only at depth 'depth', e.g. only the
+// top-level "password" field and not the nested ones, which is handy to
+// debug a particular nesting level. The fields of the input are at depth 0,
+// their own fields (or map entries) at depth 1, and so on; the elements of
+// a slice are at the depth of the slice. A negative depth (the default)
+// scrubs the fields at any depth. Secrets found by WithEntropyDetection or
+// WithValueMatchers are scrubbed at any depth.
+func WithDepth(depth int) Option {
+	return func(o *options) {
+		o.depth = depth
+	}
+}
+
+// WithMaskLenVary makes the masks of scrubbed values as long as the values
+// (in characters), e.g. "hunter2" is masked to "*******", instead of the
+// fixed-length "********" which hides their lengths. Masking tokens and
+// strategies are not affected: a token always replaces a whole value as is.
+func WithMaskLenVary(maskLenVary bool) Option {
+	return func(o *options) {
+		o.maskLenVary = maskLenVary
+	}
+}
+
+// WithMaskLen sets the length of the masks of scrubbed values, 8 by default,
+// e.g. 6 masks values to "******". It must be positive. It is ignored with
+// WithMaskLenVary, except for the values masked fully with
+// WithFixedLenFallback. Masking tokens and strategies are not affected.
+func WithMaskLen(n int) Option {
+	return func(o *options) {
+		o.maskLen = n
+	}
+}
+
+// WithDefaultSymbol sets the symbol masks are made of, '*' by default, e.g.
+// "#" masks values to "########". The symbol is repeated once per masked
+// character, whatever its size in bytes, so that a glyph such as "•" or a
+// full-width character gives masks as wide as with '*'. Masking tokens and
+// strategies are not affected.
+func WithDefaultSymbol(symbol string) Option {
+	return func(o *options) {
+		o.maskSymbol = symbol
+	}
+}
+
+// WithCaseSensitiveFields makes the comparison of field names case sensitive
+// if 'caseSensitive' is set, including for FieldGroups, excluded fields and
+// sentinel fields, e.g. so that "Password" is scrubbed but "password" is not.
+func WithCaseSensitiveFields(caseSensitive bool) Option {
+	return func(o *options) {
+		o.caseSensitive = caseSensitive
+	}
+}
+
+// WithDefaultFields sets the fields to scrub if none are given (i.e. nil),
+// instead of DefaultToScrub, without modifying the package-level default.
+func WithDefaultFields(fieldsToScrub map[string]FieldScrubOptioner) Option {
+	return func(o *options) {
+		o.defaultFields = fieldsToScrub
+	}
+}
+
+// WithPartialFallback sets a function called when a value to mask partially
+// is masked fully instead, which may reveal a misconfiguration: when a value
+// is too short for WithAlwaysShowFirst, or when the strategy of its field
+// can't handle it. The function is called with the path of the value, such
+// as "UserInfo[0].Password", and its length in characters, but never with
+// the value itself.
+func WithPartialFallback(onPartialFallback func(path string, valueLen int)) Option {
+	return func(o *options) {
+		o.onPartialFallback = onPartialFallback
+	}
+}
+
+// WithEnvironment sets the current environment, e.g. "dev" or "prod", in
+// which fields with FieldScrubOptions.MaskInEnvs or RevealInEnvs are masked
+// or revealed. It lets one configuration reveal some fields in development
+// only. The environment is empty by default.
+func WithEnvironment(environment string) Option {
+	return func(o *options) {
+		o.environment = environment
+	}
+}
+
+// WithSecretInterfaces masks every value whose type implements one of the
+// interface types 'ifaces', whatever its name, e.g. all the fields of a
+// Secret marker type with reflect.TypeOf((*Secret)(nil)).Elem(). Strings are
+// masked with the default options, and every leaf beneath structs, maps, etc.
+// is masked as with FieldScrubOptions.MaskSubtree. Types which are not
+// interfaces are ignored.
+func WithSecretInterfaces(ifaces ...reflect.Type) Option {
+	return func(o *options) {
+		o.secretInterfaces = append(o.secretInterfaces, ifaces...)
+	}
+}
+
+// WithSuffixMatch scrubs the fields whose names end with 'suffix', e.g.
+// "token" for "apiToken", "user_token" and "token", with the options
+// 'fieldOpts' (nil for the default options), for schemas where enumerating
+// every field is impractical. Names are compared as the fields to scrub are.
+// The fields to scrub, and the fields scrubbed by their struct tags, take
+// precedence; otherwise the first matching WithSuffixMatch or WithPrefixMatch
+// wins. Excluded fields are never scrubbed.
+func WithSuffixMatch(suffix string, fieldOpts FieldScrubOptioner) Option {
+	return func(o *options) {
+		o.nameMatchers = append(o.nameMatchers, nameMatcher{affix: suffix, fieldOpts: fieldOpts})
+	}
+}
+
+// WithPrefixMatch is like WithSuffixMatch, but it scrubs the fields whose
+// names start with 'prefix', e.g. "secret" for "secretKey".
+func WithPrefixMatch(prefix string, fieldOpts FieldScrubOptioner) Option {
+	return func(o *options) {
+		o.nameMatchers = append(o.nameMatchers,
+			nameMatcher{affix: prefix, prefix: true, fieldOpts: fieldOpts})
+	}
+}
+
+// WithFixedLenFallback masks the values which can't be masked partially
+// (see WithPartialFallback) with a fixed-length mask, even with
+// WithMaskLenVary, so that the lengths of the values which are too short for
+// WithAlwaysShowFirst or WithAlwaysShowLast, or which a strategy can't
+// handle, are not revealed.
+func WithFixedLenFallback(fixedLenFallback bool) Option {
+	return func(o *options) {
+		o.fixedLenFallback = fixedLenFallback
+	}
+}
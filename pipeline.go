@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// Transform is a step of a Pipeline, which returns the transformed 'value'.
+type Transform func(value string) string
+
+// Pipeline returns a Strategy which applies the 'steps' to a value in order,
+// each to the result of the previous one, e.g. NormalizeStep then
+// EmailMaskStep. The last step is the one masking the value: if it leaves its
+// input unchanged, e.g. if EmailMaskStep is given a value which is not an
+// email address, the value is masked fully, whatever the previous steps did,
+// so that a pipeline never reveals a value it didn't handle.
+func Pipeline(steps ...Transform) Strategy {
+	return func(value string) (string, bool) {
+		if len(steps) == 0 {
+			return value, false
+		}
+
+		result := value
+		for _, step := range steps[:len(steps)-1] {
+			result = step(result)
+		}
+
+		masked := steps[len(steps)-1](result)
+		return masked, masked != result
+	}
+}
+
+// NormalizeStep is a Transform which removes the leading and trailing spaces
+// of a value and lowercases it, e.g. " John@Example.com " is transformed to
+// "john@example.com".
+func NormalizeStep(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// EmailMaskStep is a Transform which masks every character of the local part
+// of an email address with '*', keeping its domain visible, e.g.
+// "john@example.com" is transformed to "****@example.com". Values which are
+// not email addresses are left as is.
+func EmailMaskStep(value string) string {
+	at := strings.LastIndexByte(value, '@')
+	if at <= 0 || at == len(value)-1 {
+		return value
+	}
+
+	return strings.Repeat("*", utf8.RuneCountInString(value[:at])) + value[at:]
+}
+
+// HashStep is a Transform which replaces a value by its hex-encoded SHA-256
+// digest, so that the same value always yields the same result.
+func HashStep(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+package scrub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Struct with an email field
+type Contact struct {
+	Name  string
+	Email string
+}
+
+// TestPipeline tests chaining masking transforms.
+func TestPipeline(t *testing.T) {
+	for value, want := range map[string]string{
+		" John.Doe@Example.com ": "********@example.com",
+		"jane@example.com":       "****@example.com",
+		"JANE@EXAMPLE.COM":       "****@example.com",
+		"not-an-email":           "********",
+		"@example.com":           "********",
+		" SECRET-TOKEN-123 ":     "********",
+		"John Smith":             "********",
+	} {
+		contact := &Contact{Name: "John Doe", Email: value}
+		contactScrubbed := &Contact{Name: "John Doe", Email: want}
+
+		validateScrubFields(t, contact, contactScrubbed, map[string]FieldScrubOptioner{
+			"email": NewMask().Pipeline(NormalizeStep, EmailMaskStep),
+		})
+	}
+
+	// Hashing a normalized value yields the same result for equal values.
+	hash := Pipeline(NormalizeStep, HashStep)
+	got1, ok1 := hash(" Jane@Example.com")
+	got2, ok2 := hash("jane@example.com")
+	assert.True(t, ok1)
+	assert.True(t, ok2)
+	assert.Equal(t, got1, got2)
+	assert.Equal(t, HashStep("jane@example.com"), got1)
+	assert.Len(t, got1, 64)
+
+	// A pipeline without steps masks nothing by itself.
+	_, ok := Pipeline()("hunter2")
+	assert.False(t, ok)
+}
@@ -18,6 +18,11 @@
 // Also, The input struct must be passed by its address, otherwise the values
 // of its fields cannot be changed.
 //
+// The sensitive fields are masked in place while the input is formatted, and
+// restored afterwards, so the input must not be read or written by other
+// goroutines during the call. Use ScrubLocked for values guarded by a mutex,
+// or scrub a value which is not shared.
+//
 // Example
 //
 //    T := testScrub{
@@ -34,66 +39,1007 @@
 package scrub
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"golang.org/x/text/cases"
 )
 
 // DefaultToScrub contains default field names to scrub.
-// NOTE: these fields should be all lowercase. Comparison is case insensitive.
+// NOTE: comparison is case insensitive, with Unicode case folding, unless
+// set otherwise with WithCaseSensitiveFields.
 var DefaultToScrub = map[string]bool{
 	"password": true,
 }
 
+// defaultFieldOpts holds the options of the fields registered with
+// RegisterDefaultField.
+var defaultFieldOpts = map[string]FieldScrubOptioner{}
+
+// DefaultFields returns a copy of the fields scrubbed when none are given,
+// i.e. DefaultToScrub with the options of the fields registered with
+// RegisterDefaultField, so that callers can scrub the defaults plus their
+// own fields without redefining them.
+func DefaultFields() map[string]FieldScrubOptioner {
+	fields := defaultFieldOptions(DefaultToScrub)
+	for name, fieldOpts := range defaultFieldOpts {
+		if DefaultToScrub[name] {
+			fields[name] = fieldOpts
+		}
+	}
+
+	return fields
+}
+
+// RegisterDefaultField adds the field 'name' to the fields scrubbed when none
+// are given, with the options 'fieldOpts' (nil for the default options). Like
+// the other package-level settings, it is not safe to call concurrently with
+// scrubbing: register the fields at initialization.
+func RegisterDefaultField(name string, fieldOpts FieldScrubOptioner) {
+	DefaultToScrub[name] = true
+	defaultFieldOpts[name] = fieldOpts
+}
+
+// FieldGroups maps a group name to the names of its member fields. It is
+// meant for secrets split across several fields, e.g. "apikey" made of
+// "keypart1" and "keypart2". When the group name or any of its members is
+// specified in the fields to scrub, all the members are scrubbed with the
+// same options: those of the group name if specified, otherwise those of
+// the specified member. Members specified explicitly keep their own options.
+// NOTE: comparison is case insensitive, with Unicode case folding, unless
+// set otherwise with WithCaseSensitiveFields.
+var FieldGroups = map[string][]string{}
+
+// PublicTypes contains types whose values are never scrubbed at any level,
+// even if the names of their fields are specified in the fields to scrub.
+// For example, a "PublicKey" wrapper type may have a "Secret" field which
+// is not sensitive at all. Register a struct type with:
+//
+//	scrub.PublicTypes[reflect.TypeOf(PublicKey{})] = true
+var PublicTypes = map[reflect.Type]bool{}
+
+// defaultMask is the value a scrubbed field is replaced with, unless the
+// field has its own masking token.
+const defaultMask = "********"
+
+// defaultMaxNesting is the default maximum nesting level of the values
+// scrubbed, see WithMaxNesting.
+const defaultMaxNesting = 256
+
+// ErrInvalidInput is returned when the input to scrub is not of the expected kind.
+var ErrInvalidInput = errors.New("scrub: invalid input")
+
+// ErrNotScrubbable is returned in strict mode when a value to be scrubbed
+// can't be scrubbed.
+var ErrNotScrubbable = errors.New("scrub: value can't be scrubbed")
+
+// ErrTooManyMapEntries is returned in strict mode when the maps of the input
+// have more entries in total than allowed by WithMaxMapEntries.
+var ErrTooManyMapEntries = errors.New("scrub: too many map entries")
+
+// ErrTooDeep is returned in strict mode when the input is nested deeper than
+// allowed by WithMaxNesting.
+var ErrTooDeep = errors.New("scrub: value nested too deep")
+
+// FieldScrubOptioner is implemented by types which provide the options to
+// scrub a field with, such as *FieldScrubOptions.
+type FieldScrubOptioner interface {
+	// ScrubOptions returns the options to scrub a field with. A nil return
+	// value selects the default options.
+	ScrubOptions() *FieldScrubOptions
+}
+
+// FieldScrubOptions holds the options to scrub a single field.
+type FieldScrubOptions struct {
+	// Token, if not empty, replaces the whole value of the field instead
+	// of the default mask. It gives a readable, field-identifying redaction
+	// such as "<pw>" for a password or "<ssn>" for a social security number.
+	// It is used as is, e.g. "[REDACTED]", whatever the length of the value
+	// and the options of the call.
+	Token string
+
+	// Strategy, if not nil, masks the value of the field in its own way,
+	// e.g. JWTSignatureMask. It is ignored if Token is set.
+	Strategy Strategy
+
+	// KeyByPath, if set, keys the digest of a Strategy set with Mask.Hash
+	// with the path of the field through struct fields, without map keys or
+	// slice indexes, e.g. "Users.Password", or "Accounts.password" for the
+	// "password" entry of an Accounts map. The same value then yields
+	// different results in different fields, so that they can't be
+	// correlated, while it yields the same result in the same field. It is
+	// ignored with other strategies, and reported by Scrubber.Validate.
+	KeyByPath bool
+
+	// Symbol, if not empty, is the symbol the masks of the field are made
+	// of, instead of the one set with WithDefaultSymbol.
+	Symbol string
+
+	// ShowFirst and ShowLast, if either is positive, are the numbers of
+	// leading and trailing characters of the field kept visible, instead of
+	// those set with WithAlwaysShowFirst and WithAlwaysShowLast, e.g. 6 and 4
+	// for card numbers. As with those, values of at most twice as many
+	// characters as are visible are masked fully.
+	ShowFirst int
+	ShowLast  int
+
+	// keyedStrategy, if not nil, returns Strategy keyed with the path of a
+	// field, see KeyByPath.
+	keyedStrategy func(path string) Strategy
+
+	// MaskSubtree, if set, masks every leaf value beneath the field if it is
+	// a struct, map, slice, etc., with the options of the field, whether or
+	// not the leaves are to be scrubbed themselves. Unlike a Token replacing
+	// a whole object, it keeps the structure of the field visible.
+	MaskSubtree bool
+
+	// ScrubNonString, if set, also scrubs the numbers and booleans of the
+	// field, which are otherwise left as is: they are set to 0 and false.
+	ScrubNonString bool
+
+	// PreserveNumberFormat, if set along with ScrubNonString, replaces the
+	// numbers of the field which can be replaced by a string, i.e. those
+	// held by interfaces, such as the values of a map[string]interface{},
+	// and those of raw JSON, by a string with their digits masked and their
+	// sign, decimal point and exponent kept, e.g. -1234.56 by "-****.**",
+	// to hint their shape. The other numbers are set to 0.
+	PreserveNumberFormat bool
+
+	// MaskInEnvs, if not empty, lists the environments in which the field is
+	// masked, e.g. []string{"prod"}, see WithEnvironment. In the other
+	// environments, the field is revealed.
+	MaskInEnvs []string
+
+	// RevealInEnvs lists the environments in which the field is revealed,
+	// e.g. []string{"dev"}, see WithEnvironment. It takes precedence over
+	// MaskInEnvs.
+	RevealInEnvs []string
+
+	// When, if not nil, scrubs the field only if it returns true for the
+	// string values of its siblings, i.e. the other fields of its struct or
+	// the other entries of its map, keyed by their folded names (e.g.
+	// "type" for a Type field, see WithCaseSensitiveFields). The siblings
+	// are read before any of them is scrubbed, whatever their order. It
+	// scrubs values depending on another field, such as the "value" of
+	// {"type": "ssn", "value": "123-45-6789"}.
+	When func(siblings map[string]string) bool
+
+	// Drop, if set, removes the field rather than masking it, so that its
+	// existence isn't revealed: map entries, including those of raw JSON,
+	// are deleted. Struct fields can't be removed, so strings are emptied
+	// instead; other values are scrubbed as usual.
+	Drop bool
+
+	// Truncate, if positive, truncates the time.Time values of the field
+	// to a multiple of it since the zero time, e.g. 24*time.Hour keeps only
+	// the date of UTC times, instead of zeroing them.
+	Truncate time.Duration
+}
+
+// ScrubOptions returns 'o' itself, so that *FieldScrubOptions can be used
+// as a FieldScrubOptioner.
+func (o *FieldScrubOptions) ScrubOptions() *FieldScrubOptions {
+	return o
+}
+
 // Scrub scrubs all the specified string fields in the 'input' struct
 // at any level recursively and returns a JSON-formatted string of the
-// scrubbed struct.
-func Scrub(input interface{}, fieldsToScrub map[string]bool) string {
-	if input == nil {
-		// Return json representation of 'nil' input
-		return "null"
+// scrubbed struct. The scrubbing can be configured further with 'opts'.
+//
+// The JSON output of values with a MarshalJSON method, which can hold
+// secrets out of reach of their fields, is scrubbed as well, as by ScrubJSON.
+func Scrub(input interface{}, fieldsToScrub map[string]bool, opts ...Option) string {
+	var fields map[string]FieldScrubOptioner
+	if fieldsToScrub != nil {
+		fields = defaultFieldOptions(fieldsToScrub)
+	}
+
+	return ScrubFields(input, fields, opts...)
+}
+
+// ScrubFields is like Scrub, but each field to scrub carries its own
+// scrubbing options. A nil FieldScrubOptioner scrubs the field with the
+// default options. If 'fieldsToScrub' is nil, DefaultFields is used.
+//
+// A field name can be qualified with the names of the struct fields (or map
+// keys) holding it, e.g. "credentials.password" for the Password field of a
+// Credentials field, embedded or not, and not for other Password fields. Slice
+// elements are named after their slice. Qualified names take precedence over
+// shorter ones.
+func ScrubFields(input interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) string {
+	return ScrubValue(input, fieldsToScrub, opts...)
+}
+
+// ScrubValue is like ScrubFields, but 'target' doesn't need to be a pointer:
+// if it is a struct (or any other value) rather than a pointer to it, a copy
+// of it is scrubbed, which can't be done in place. The copy shares the
+// slices, maps and pointed-to values of 'target', which are restored after
+// scrubbing as usual: they must not be modified concurrently, see ScrubLocked.
+func ScrubValue(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) string {
+	out, _ := scrub(addressable(target), fieldsToScrub, opts)
+	return out
+}
+
+// addressable returns 'target' if it is nil or a pointer, or a pointer to a
+// fresh copy of it otherwise, so that it can be scrubbed.
+func addressable(target interface{}) interface{} {
+	if target == nil || reflect.ValueOf(target).Kind() == reflect.Ptr {
+		return target
+	}
+
+	targetCopy := reflect.New(reflect.TypeOf(target))
+	targetCopy.Elem().Set(reflect.ValueOf(target))
+	return targetCopy.Interface()
+}
+
+// ScrubE is like ScrubFields, but it returns an error instead of an output
+// which can't be told apart from a legitimate one, so that a failing scrub
+// can be detected. It returns an error wrapping ErrInvalidInput if 'input'
+// is neither nil nor a pointer, as its fields could not be scrubbed, or
+// wrapping the error of marshalling the scrubbed 'input'.
+func ScrubE(input interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) (string, error) {
+	if input != nil && reflect.ValueOf(input).Kind() != reflect.Ptr {
+		return "", fmt.Errorf("%w: %T is not a pointer", ErrInvalidInput, input)
 	}
 
+	return scrub(input, fieldsToScrub, opts)
+}
+
+// ScrubWithOptions is like ScrubValue, but the scrubbed 'target' is formatted
+// as 'dataType' (see WithDataType), and it also returns the error, if any,
+// of marshalling it.
+func ScrubWithOptions(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	dataType DataType, opts ...Option) (string, error) {
+	opts = append(opts[:len(opts):len(opts)], WithDataType(dataType))
+	return scrub(addressable(target), fieldsToScrub, opts)
+}
+
+// ScrubAndWrite is like ScrubWithOptions, but it appends the scrubbed
+// 'target' to 'buf' instead of returning a string, e.g. for loggers reusing
+// buffers from a sync.Pool, which saves allocating the string. It returns the
+// error, if any, of marshalling it, in which case 'buf' is left as it was.
+func ScrubAndWrite(buf *bytes.Buffer, target interface{},
+	fieldsToScrub map[string]FieldScrubOptioner, opts ...Option) error {
+	return newScrubState(fieldsToScrub, opts).scrubTo(buf, addressable(target))
+}
+
+// ScrubTo is like ScrubWithOptions, but it writes the scrubbed 'target' to
+// 'w' as it is marshalled, e.g. to an http.ResponseWriter or a log file,
+// without building a string of it in memory. JSON is followed by a newline,
+// as written by json.Encoder. It returns the error, if any, of marshalling
+// it or of writing to 'w'.
+func ScrubTo(w io.Writer, target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) error {
+	state := newScrubState(fieldsToScrub, opts)
+	input := addressable(target)
+	return state.scrubWith(input, func() error {
+		return state.encodeTo(w, input)
+	})
+}
+
+// ScrubStruct is like ScrubFields, but it leaves 'target' scrubbed in place
+// instead of returning a formatted string of it, so that the scrubbed value
+// can be used programmatically, e.g. passed to another logger. Unlike the
+// other functions, it does NOT restore the original values, including those
+// of the slices, maps and structs referred to by 'target': scrub a copy of
+// anything still needed. It returns an error wrapping ErrInvalidInput if
+// 'target' is not a non-nil pointer, or the error which stopped the
+// scrubbing in strict mode, in which case 'target' is left unchanged.
+func ScrubStruct(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return fmt.Errorf("%w: %T is not a non-nil pointer", ErrInvalidInput, target)
+	}
+
+	state := newScrubState(fieldsToScrub, opts)
+	scrubInternal(target, "", "", state)
+	if state.err != nil {
+		state.restore()
+		return state.err
+	}
+
+	return nil
+}
+
+// ScrubContext is like ScrubWithOptions, formatting the scrubbed 'target' as
+// set with WithDataType, but the scrubbing stops as soon as 'ctx' is done, e.g.
+// when the client of a request handler disconnects, so that a huge value
+// doesn't hold a goroutine for long. It then returns the error of 'ctx',
+// after restoring 'target'. The marshalling itself is not interrupted.
+func ScrubContext(ctx context.Context, target interface{},
+	fieldsToScrub map[string]FieldScrubOptioner, opts ...Option) (string, error) {
+	state := newScrubState(fieldsToScrub, opts)
+	state.ctx = ctx
+	return state.scrub(addressable(target))
+}
+
+// ScrubLocked is like ScrubValue, but it holds 'mu' for the whole scrubbing,
+// from masking 'target' to restoring it, for values shared with goroutines
+// which modify them while holding 'mu'. Locking only around the formatting
+// is not enough, as 'target' is modified in place before it.
+func ScrubLocked(mu sync.Locker, target interface{},
+	fieldsToScrub map[string]FieldScrubOptioner, opts ...Option) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return ScrubValue(target, fieldsToScrub, opts...)
+}
+
+// ScrubReport is a dry run of ScrubValue: it returns the sorted paths, such as
+// "UserInfo[0].Password" or "Events[0].password", of the values which would be
+// masked in 'target', without formatting it. It lets a configuration be
+// checked against a representative value, e.g. in tests. 'target' is
+// restored before returning. It returns the error which stopped the
+// scrubbing in strict mode, if any.
+func ScrubReport(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) ([]string, error) {
+	state := newScrubState(fieldsToScrub, opts)
+	state.lengths = make(map[string]int)
+	if err := state.scrubWith(addressable(target), func() error { return nil }); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(state.lengths))
+	for path := range state.lengths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// ScrubBoth is like ScrubStruct, leaving 'target' scrubbed in place, but it
+// also returns 'target' formatted as set with WithDataType, for callers which
+// both log a value and keep its scrubbed copy: scrub a copy of anything still
+// needed. It returns 'target' itself along with its formatted string. It
+// returns an error wrapping ErrInvalidInput if 'target' is not a non-nil
+// pointer, the error which stopped the scrubbing in strict mode, in which
+// case 'target' is left unchanged, or the error of marshalling it. Unlike
+// ScrubFields, it doesn't scrub the output of MarshalJSON methods, as it
+// formats 'target' as left in place.
+func ScrubBoth(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) (interface{}, string, error) {
+	if err := ScrubStruct(target, fieldsToScrub, opts...); err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, target, newOptions(opts).dataType); err != nil {
+		return nil, "", err
+	}
+
+	return target, buf.String(), nil
+}
+
+// ScrubSlice scrubs the specified string fields in each element of the slice
+// pointed to by 'target', such as a *[]User or a *[]*User, and returns a
+// JSON-formatted string of the scrubbed slice. It saves wrapping a slice in
+// a struct to scrub it. It returns an error wrapping ErrInvalidInput if
+// 'target' is not a pointer to a slice, or the error, if any, of marshalling
+// the scrubbed slice.
+func ScrubSlice(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) (string, error) {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() ||
+		targetValue.Elem().Kind() != reflect.Slice {
+		return "", fmt.Errorf("%w: %T is not a pointer to a slice", ErrInvalidInput, target)
+	}
+
+	return scrub(target, fieldsToScrub, opts)
+}
+
+// scrub implements ScrubFields, returning any marshalling error as well.
+func scrub(input interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts []Option) (string, error) {
+	return newScrubState(fieldsToScrub, opts).scrub(input)
+}
+
+// scrubState holds the configuration and the progress of a single scrubbing
+// call, shared by all the recursive calls of scrubInternal.
+type scrubState struct {
+	// Effective fields to scrub, see resolveFields.
+	fieldsToScrub map[string]FieldScrubOptioner
+	// Options of the call.
+	opts *options
+	// Functions to restore the original values of the scrubbed fields.
+	restoreFuncs []func()
+	// Number of map entries scrubbed so far.
+	mapEntries int
+	// First error found in strict mode, which stops the scrubbing.
+	err error
+	// Options of the field whose subtree is being masked, if any.
+	subtreeOpts FieldScrubOptioner
+	// Number of values masked so far, and their original lengths by path,
+	// if requested.
+	masked  int
+	lengths map[string]int
+	// Name and options of the struct field being scrubbed as per its tag.
+	taggedField string
+	tagOpts     FieldScrubOptioner
+	// Depth of the field being scrubbed, -1 for the input itself.
+	depth int
+	// Names of the struct fields and map keys leading to the field being
+	// scrubbed, and the largest number of names of the path-qualified fields
+	// to scrub, such as "credentials.password".
+	names     []string
+	qualified int
+	// Number of nested values being scrubbed, and the pointers, maps and
+	// slices among them.
+	nesting    int
+	references []reference
+	// Context whose cancellation stops the scrubbing, if any.
+	ctx context.Context
+	// Whether some fields to scrub have FieldScrubOptions.When, and the
+	// string values of the siblings of the field being scrubbed.
+	conditional bool
+	siblings    map[string]string
+	// Whether some fields to scrub have FieldScrubOptions.KeyByPath, and the
+	// paths of the struct field being scrubbed and of the field itself, see
+	// KeyByPath.
+	keyed     bool
+	structKey string
+	fieldKey  string
+	// Whether some fields to scrub have FieldScrubOptions.MaskSubtree.
+	subtree bool
+	// Leaves masked in place, which may be reached again through other
+	// pointers, if any.
+	maskedLeaves map[leaf]bool
+	// Last field name folded, and its folded form, as a field is looked up
+	// several times in a row.
+	lastName   string
+	lastFolded string
+	// Whether the input is formatted as JSON, and the scrubbed outputs of
+	// its json.Marshaler values to substitute then, by their positions in it.
+	substitutes   bool
+	substitutions []jsonSubstitution
+	// Position in the JSON formatting of the input of the value being
+	// scrubbed, and the number of json.Marshaler values being scrubbed.
+	jsonPath   []jsonStep
+	marshaling int
+	// Substitutions of the json.Marshaler values scrubbed in place, nil if
+	// nothing was masked in their outputs.
+	marshaled map[leaf]*jsonSubstitution
+}
+
+// newScrubState returns the state of a scrubbing call of 'fieldsToScrub'
+// configured with 'opts'. If 'fieldsToScrub' is nil, DefaultFields is used.
+func newScrubState(fieldsToScrub map[string]FieldScrubOptioner, opts []Option) *scrubState {
+	callOpts := newOptions(opts)
 	if fieldsToScrub == nil {
-		fieldsToScrub = DefaultToScrub
+		fieldsToScrub = callOpts.defaultFields
 	}
 
+	if fieldsToScrub == nil {
+		fieldsToScrub = DefaultFields()
+	}
+
+	fields := resolveFields(fieldsToScrub, callOpts)
+	qualified := 1
+	for name := range fields {
+		if n := strings.Count(name, ".") + 1; n > qualified {
+			qualified = n
+		}
+	}
+
+	conditional, keyed, subtree := false, false, false
+	for _, fieldOpts := range fields {
+		conditional = conditional || fieldOptions(fieldOpts).When != nil
+		keyed = keyed || fieldOptions(fieldOpts).KeyByPath
+		subtree = subtree || fieldOptions(fieldOpts).MaskSubtree
+	}
+	for _, matcher := range callOpts.nameMatchers {
+		conditional = conditional || fieldOptions(matcher.fieldOpts).When != nil
+		keyed = keyed || fieldOptions(matcher.fieldOpts).KeyByPath
+		subtree = subtree || fieldOptions(matcher.fieldOpts).MaskSubtree
+	}
+
+	return &scrubState{
+		fieldsToScrub: fields,
+		opts:          callOpts,
+		depth:         -1,
+		qualified:     qualified,
+		conditional:   conditional,
+		keyed:         keyed,
+		subtree:       subtree,
+	}
+}
+
+// scrub scrubs 'input' and returns a JSON-formatted string of it, along with
+// any marshalling error. 'input' is restored before returning.
+func (s *scrubState) scrub(input interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := s.scrubTo(&buf, input)
+	return buf.String(), err
+}
+
+// scrubTo is like scrub, but it writes the formatted string to 'buf'. On
+// error, 'buf' is left as it was.
+func (s *scrubState) scrubTo(buf *bytes.Buffer, input interface{}) error {
+	return s.scrubWith(input, func() error {
+		return s.encode(buf, input)
+	})
+}
+
+// scrubWith scrubs 'input', calls 'write' to write it formatted, and restores
+// 'input'. 'write' is not called if the scrubbing fails in strict mode. A nil
+// input is formatted as null.
+func (s *scrubState) scrubWith(input interface{}, write func() error) error {
+	s.substitutes = s.opts.dataType == "" || s.opts.dataType == JSONScrub
+
 	// Call a recursive function to find and scrub fields in input at any level.
-	savedValues := make([]string, 0)
-	scrubInternal(input, "", fieldsToScrub, &savedValues, true /* mask */)
+	scrubInternal(input, "", "", s)
+
+	if s.err != nil {
+		// Don't return a partially scrubbed struct.
+		s.restore()
+		return s.err
+	}
 
-	// Get a JSON marshalled string from the scrubb string to return.
-	var b []byte
-	b, _ = json.Marshal(input)
+	err := write()
 
 	// Restore all the scrubbed values back to the original values in the struct.
-	scrubInternal(input, "", fieldsToScrub, &savedValues, false /* unmask */)
+	s.restore()
+
+	return err
+}
+
+// report reports the 'original' value masked at 'path'.
+func (s *scrubState) report(path, original string) {
+	s.masked++
+	reportOriginal(path, original)
+	if s.lengths != nil {
+		s.lengths[path] = utf8.RuneCountInString(original)
+	}
+}
+
+// saveRestoreFunc saves 'f', a function to restore the original value of a
+// scrubbed field.
+func (s *scrubState) saveRestoreFunc(f func()) {
+	s.restoreFuncs = append(s.restoreFuncs, f)
+}
+
+// leafOptions returns the options to scrub a leaf value named 'fieldName'
+// with, or false if the value is not to be scrubbed.
+func (s *scrubState) leafOptions(fieldName string) (FieldScrubOptioner, bool) {
+	if s.subtreeOpts != nil {
+		// Every leaf of a masked subtree is scrubbed as per its root field.
+		return s.subtreeOpts, true
+	}
+
+	// If 'fieldName' is not set, then the API was not called on a struct.
+	// Since it is not possible to find the variable name of a non-struct field,
+	// we can't compare it with 'fieldsToScrub'.
+	if fieldName == "" {
+		return nil, false
+	}
+
+	return s.lookupField(fieldName)
+}
+
+// isLeaf returns true if the value named 'fieldName' is to be scrubbed as a
+// whole, see leafOptions.
+func (s *scrubState) isLeaf(fieldName string) bool {
+	_, ok := s.leafOptions(fieldName)
+	return ok
+}
+
+// lookupField returns the options to scrub the field 'fieldName' with, or
+// false if it is not to be scrubbed, including in the current environment.
+// The fields to scrub take precedence over the struct tag of the field, see
+// enterTaggedField.
+func (s *scrubState) lookupField(fieldName string) (FieldScrubOptioner, bool) {
+	if s.opts.depth >= 0 && s.depth != s.opts.depth {
+		return nil, false
+	}
+
+	// Path-qualified fields take precedence, the most qualified first.
+	for n := s.qualified; n >= 2; n-- {
+		if n > len(s.names) {
+			continue
+		}
+
+		qualifiedName := s.opts.fold(strings.Join(s.names[len(s.names)-n:], "."))
+		if fieldOpts, ok := s.fieldsToScrub[qualifiedName]; ok {
+			return fieldOpts, s.applies(fieldOpts)
+		}
+	}
+
+	name := s.fold(fieldName)
+	if fieldOpts, ok := s.fieldsToScrub[name]; ok {
+		return fieldOpts, s.applies(fieldOpts)
+	}
+
+	if s.tagOpts != nil && fieldName == s.taggedField && !s.opts.excludedFields[name] {
+		return s.tagOpts, s.applies(s.tagOpts)
+	}
+
+	if !s.opts.excludedFields[name] {
+		for _, matcher := range s.opts.nameMatchers {
+			if matcher.matches(name) {
+				return matcher.fieldOpts, s.applies(matcher.fieldOpts)
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// fold returns the folded form of the field name 'fieldName', see
+// options.fold, remembering the last one.
+func (s *scrubState) fold(fieldName string) string {
+	if fieldName != s.lastName {
+		s.lastName, s.lastFolded = fieldName, s.opts.fold(fieldName)
+	}
+
+	return s.lastFolded
+}
+
+// enterField starts scrubbing the field 'fieldName' of a struct, whose
+// folded name is 'folded' unless field names are case sensitive.
+func (s *scrubState) enterField(fieldName, folded string) {
+	if !s.opts.caseSensitive {
+		s.lastName, s.lastFolded = fieldName, folded
+	}
+}
+
+// leaf is the address and the type of a value masked in place. The address
+// is kept as a pointer, so that the copies scrubbed by scrubCopy are not
+// freed, and their addresses reused by later copies, during the scrubbing.
+type leaf struct {
+	addr unsafe.Pointer
+	typ  reflect.Type
+}
+
+// leafOf returns the leaf of 'targetValue', or the zero leaf if it is not
+// addressable.
+func leafOf(targetValue reflect.Value) leaf {
+	if !targetValue.CanAddr() {
+		return leaf{}
+	}
+
+	return leaf{addr: unsafe.Pointer(targetValue.UnsafeAddr()), typ: targetValue.Type()}
+}
+
+// maskedLeaf records that 'targetValue' was masked in place, so that it is
+// not masked again if it is reached through another pointer.
+func (s *scrubState) maskedLeaf(targetValue reflect.Value) {
+	if !targetValue.CanAddr() {
+		return
+	}
+
+	if s.maskedLeaves == nil {
+		s.maskedLeaves = make(map[leaf]bool)
+	}
+	s.maskedLeaves[leafOf(targetValue)] = true
+}
+
+// enterKey starts scrubbing the field 'name', a struct field if 'isField'
+// is set or a map entry otherwise, for FieldScrubOptions.KeyByPath. It
+// returns a function to call when leaving the field.
+func (s *scrubState) enterKey(name string, isField bool) func() {
+	if !s.keyed {
+		return func() {}
+	}
+
+	structKey, fieldKey := s.structKey, s.fieldKey
+	s.fieldKey = fieldPath(s.structKey, name)
+	if isField {
+		s.structKey = s.fieldKey
+	}
+
+	return func() { s.structKey, s.fieldKey = structKey, fieldKey }
+}
+
+// scrubText returns the text 'text' named 'name' at 'path', scrubbed with
+// 'state', for the formats scrubbed without a Go value. Blank text, such as
+// the indentation between XML elements, is never scrubbed.
+func scrubText(text, name, path string, state *scrubState) string {
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+
+	if fieldOpts, ok := state.stringOptions(name, text); ok {
+		state.report(path, text)
+		return maskValue(text, fieldOpts, path, state)
+	}
+
+	if masked, ok := state.maskMatches(name, text); ok {
+		state.report(path, text)
+		return masked
+	}
+
+	return text
+}
+
+// enterNesting starts scrubbing a value nested one level deeper at 'path',
+// unless the scrubbing was stopped by an error or cancelled, or the value is
+// nested too deep (see WithMaxNesting), in which case it returns false.
+// Otherwise, leaveNesting must be called when leaving it.
+func (s *scrubState) enterNesting(path string) bool {
+	if s.err != nil {
+		// Scrubbing was stopped by an error.
+		return false
+	}
+
+	if s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			// Scrubbing was cancelled, whether in strict mode or not.
+			s.err = err
+			return false
+		}
+	}
+
+	if s.nesting >= s.opts.maxNesting {
+		// Stop at absurdly deep values rather than overflowing the stack.
+		s.fail(fmt.Errorf("%w: %s: more than %d levels", ErrTooDeep, path, s.opts.maxNesting))
+		return false
+	}
+
+	s.nesting++
+	return true
+}
+
+// leaveNesting ends scrubbing the value of the last call of enterNesting.
+func (s *scrubState) leaveNesting() {
+	s.nesting--
+}
+
+// reference identifies a pointer, a map or a slice being scrubbed. A struct
+// and its first field have the same address, so the type is part of it, and
+// so is the length of slices, as slices of different lengths may share their
+// first element.
+type reference struct {
+	addr uintptr
+	len  int
+	typ  reflect.Type
+}
+
+// enterReference starts scrubbing the value referred to by the pointer, map
+// or slice 'targetValue', unless it is already being scrubbed, i.e. it refers
+// to itself, in which case it returns false. Otherwise, leaveReference must
+// be called when leaving it.
+func (s *scrubState) enterReference(targetValue reflect.Value) bool {
+	ref := reference{addr: targetValue.Pointer(), typ: targetValue.Type()}
+	if targetValue.Kind() == reflect.Slice {
+		ref.len = targetValue.Len()
+	}
+
+	for _, entered := range s.references {
+		if entered == ref {
+			return false
+		}
+	}
+
+	s.references = append(s.references, ref)
+	return true
+}
+
+// leaveReference ends scrubbing the value of the last call of enterReference.
+func (s *scrubState) leaveReference() {
+	s.references = s.references[:len(s.references)-1]
+}
+
+// drops returns true if the field 'fieldName' is to be removed rather than
+// masked, see FieldScrubOptions.Drop.
+func (s *scrubState) drops(fieldName string) bool {
+	fieldOpts, ok := s.leafOptions(fieldName)
+	return ok && fieldOptions(fieldOpts).Drop
+}
+
+// applies returns true if the field with the options 'fieldOpts' is to be
+// scrubbed in the current environment and given its siblings.
+func (s *scrubState) applies(fieldOpts FieldScrubOptioner) bool {
+	if !s.opts.masksIn(fieldOpts) {
+		return false
+	}
+
+	when := fieldOptions(fieldOpts).When
+	return when == nil || when(s.siblings)
+}
+
+// enterSiblings starts scrubbing the fields of the struct or the entries of
+// the map 'targetValue', recording their string values for
+// FieldScrubOptions.When. It returns a function to call when leaving it.
+func (s *scrubState) enterSiblings(targetValue reflect.Value) func() {
+	if !s.conditional {
+		return func() {}
+	}
+
+	siblings := make(map[string]string)
+	if targetType := targetValue.Type(); targetType.Kind() == reflect.Struct {
+		for i := 0; i < targetType.NumField(); i++ {
+			if field := targetType.Field(i); field.IsExported() {
+				addSibling(siblings, s.opts.fold(field.Name), targetValue.Field(i))
+			}
+		}
+	} else {
+		iter := targetValue.MapRange()
+		for iter.Next() {
+			addSibling(siblings, s.opts.fold(iter.Key().String()), iter.Value())
+		}
+	}
+
+	prev := s.siblings
+	s.siblings = siblings
+	return func() { s.siblings = prev }
+}
+
+// addSibling adds the value 'value' of the sibling 'name' to 'siblings' if
+// it is a string, possibly held by an interface or a pointer.
+func addSibling(siblings map[string]string, name string, value reflect.Value) {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.String {
+		siblings[name] = value.String()
+	}
+}
+
+// stringOptions is like leafOptions for the string 'value', which is also to
+// be scrubbed with the default options if it looks like a secret whatever
+// its name, see WithEntropyDetection.
+func (s *scrubState) stringOptions(fieldName, value string) (FieldScrubOptioner, bool) {
+	if fieldOpts, ok := s.leafOptions(fieldName); ok {
+		return fieldOpts, true
+	}
+
+	if s.opts.excludedFields[s.fold(fieldName)] {
+		return nil, false
+	}
+
+	return nil, s.opts.highEntropy(value)
+}
+
+// enterSubtree starts masking every leaf beneath the field 'fieldName', if it
+// is to be scrubbed with FieldScrubOptions.MaskSubtree. It returns a function
+// to call when leaving the field.
+func (s *scrubState) enterSubtree(fieldName string) func() {
+	if s.subtreeOpts != nil || fieldName == "" {
+		return func() {}
+	}
+
+	if !s.subtree && s.tagOpts == nil {
+		// Only the options of a struct tag may mask the subtree then.
+		return func() {}
+	}
+
+	fieldOpts, ok := s.lookupField(fieldName)
+	if !ok || !fieldOptions(fieldOpts).MaskSubtree {
+		return func() {}
+	}
+
+	s.subtreeOpts = fieldOpts
+	return func() { s.subtreeOpts = nil }
+}
+
+// enterSecretType starts masking every leaf beneath a value of type
+// 'targetType', if it implements one of the interfaces set with
+// WithSecretInterfaces. It returns a function to call when leaving the value.
+func (s *scrubState) enterSecretType(targetType reflect.Type) func() {
+	if s.subtreeOpts != nil {
+		return func() {}
+	}
 
-	// Return the scrubbed string
-	return string(b)
+	for _, iface := range s.opts.secretInterfaces {
+		if iface == nil || iface.Kind() != reflect.Interface {
+			continue
+		}
+
+		if targetType.Implements(iface) || reflect.PtrTo(targetType).Implements(iface) {
+			s.subtreeOpts = &FieldScrubOptions{}
+			return func() { s.subtreeOpts = nil }
+		}
+	}
+
+	return func() {}
+}
+
+// enterRecord starts masking every leaf beneath the struct 'targetValue', if
+// it is a record to redact fully as per WithSentinelField. It returns a
+// function to call when leaving the struct.
+func (s *scrubState) enterRecord(targetValue reflect.Value) func() {
+	if s.subtreeOpts != nil || s.opts.sentinelField == "" {
+		return func() {}
+	}
+
+	targetType := targetValue.Type()
+	for i := 0; i < targetType.NumField(); i++ {
+		fType := targetType.Field(i)
+		if !fType.IsExported() || s.opts.fold(fType.Name) != s.opts.sentinelField {
+			continue
+		}
+
+		if reflect.DeepEqual(targetValue.Field(i).Interface(), s.opts.sentinelValue) {
+			s.subtreeOpts = &FieldScrubOptions{}
+			return func() { s.subtreeOpts = nil }
+		}
+	}
+
+	return func() {}
 }
 
-// scrubInternal scrubs all the specified string fields in the 'input' struct
-// at any level recursively and returns a JSON formatted string of the scrubbed struct.
-// It restores the struct back to the original values before returning.
+// countMapEntry counts a map entry about to be scrubbed. It returns false if
+// the entry exceeds the limit set by WithMaxMapEntries, in which case the
+// entry must be skipped. In strict mode, it also stops the scrubbing with
+// ErrTooManyMapEntries.
+func (s *scrubState) countMapEntry() bool {
+	s.mapEntries++
+	if s.opts.maxMapEntries <= 0 || s.mapEntries <= s.opts.maxMapEntries {
+		return true
+	}
+
+	s.fail(fmt.Errorf("%w: more than %d", ErrTooManyMapEntries, s.opts.maxMapEntries))
+	return false
+}
+
+// fail stops the scrubbing with 'err' in strict mode. Otherwise, the problem
+// reported by 'err' is tolerated.
+func (s *scrubState) fail(err error) {
+	if s.opts.strict && s.err == nil {
+		s.err = err
+	}
+}
+
+// restore calls the saved restore functions in the reverse order to restore
+// the original values of all the scrubbed fields.
+func (s *scrubState) restore() {
+	for i := len(s.restoreFuncs) - 1; i >= 0; i-- {
+		s.restoreFuncs[i]()
+	}
+	s.restoreFuncs = nil
+}
+
+// scrubInternal scrubs all the specified string fields in the 'target' struct
+// at any level recursively.
 //
 // It loops over the given 'target' struct recursively, looking for 'string'
-// field names specified in 'fieldsToScrub'. If found, it saves the value in
-// 'savedValues' and scrubs the value with '********'.
-// If 'mask' is set to false, then it reverses the operation by replacing all masked
-// fields with the original value saved in 'savedValues'.
-//
-// A typical usage is to call this API with an empty 'savedValues' with 'mask' as true to
-// scrub all sensitive values in the struct. Afterwards, call it back with the filled
-// 'savedValues' with 'mask' as false to restore the original struct.
+// field names specified in the fields to scrub of 'state'. If found, it scrubs
+// the value with '********' (or as per the options of the field and the call),
+// and saves a function in 'state' which restores the original value.
+// 'fieldName' and 'path' are the name and the path (e.g. "UserInfo[0].Password")
+// of 'target' in the struct being scrubbed; both are empty at the top level.
 //
-// NOTE: 'savedValues' must be preserved by the caller to restore the original struct
-// and must not be modified.
+// A typical usage is to call this API with a new 'state' to scrub all sensitive
+// values in the struct. Afterwards, call state.restore() to restore the original
+// struct.
 //
 // This is an internal API. It should not be used directly by any caller.
-func scrubInternal(target interface{}, fieldName string, fieldsToScrub map[string]bool,
-	savedValues *[]string, mask bool) {
+func scrubInternal(target interface{}, fieldName, path string, state *scrubState) {
+	if !state.enterNesting(path) {
+		return
+	}
 
+	// What is entered for every value is left without a defer, which would
+	// cost more than scrubbing most values.
+	leaveSubtree := state.enterSubtree(fieldName)
+	scrubTarget(target, fieldName, path, state)
+	leaveSubtree()
+	state.leaveNesting()
+}
+
+// scrubTarget scrubs the value pointed to by 'target', named 'fieldName' at
+// 'path', see scrubInternal.
+func scrubTarget(target interface{}, fieldName, path string, state *scrubState) {
 	// if target is not pointer, then immediately return
 	// modifying struct's field requires addressable object
 	addrValue := reflect.ValueOf(target)
@@ -106,94 +1052,631 @@ func scrubInternal(target interface{}, fieldName string, fieldsToScrub map[strin
 		return
 	}
 
-	targetType := targetValue.Type()
-
 	// If the field/struct is passed by pointer, then first dereference it to get the
 	// underlying value (the pointer must not be pointing to a nil value).
-	if targetType.Kind() == reflect.Ptr && !targetValue.IsNil() {
-		targetValue = targetValue.Elem()
-		if !targetValue.IsValid() {
+	if targetValue.Kind() == reflect.Ptr && !targetValue.IsNil() {
+		if !state.enterReference(targetValue) {
 			return
 		}
 
-		targetType = targetValue.Type()
+		scrubValue(targetValue.Elem(), fieldName, path, state)
+		state.leaveReference()
+		return
 	}
 
-	if targetType.Kind() == reflect.Struct {
-		// If target is a struct then recurse on each of its field.
-		for i := 0; i < targetType.NumField(); i++ {
-			fType := targetType.Field(i)
-			fValue := targetValue.Field(i)
-			if !fValue.IsValid() {
-				continue
-			}
+	scrubValue(targetValue, fieldName, path, state)
+}
 
-			if !fValue.CanAddr() {
-				// Cannot take pointer of this field, so can't scrub it.
-				continue
-			}
+// scrubValue scrubs the addressable 'targetValue', named 'fieldName' at
+// 'path', see scrubInternal.
+func scrubValue(targetValue reflect.Value, fieldName, path string, state *scrubState) {
+	if !targetValue.IsValid() {
+		return
+	}
+
+	targetType := targetValue.Type()
+	if targetType.Kind() == reflect.Ptr && targetValue.IsNil() {
+		// A nil pointer holds nothing to scrub, and calling the methods of
+		// its type, such as driver.Valuer's, may panic.
+		return
+	}
+
+	if PublicTypes[targetType] {
+		// Nothing in this type is sensitive.
+		return
+	}
+
+	leaveSecretType := state.enterSecretType(targetType)
+	scrubTyped(targetValue, targetType, fieldName, path, state)
+	leaveSecretType()
+}
+
+// scrubTyped scrubs 'targetValue' of type 'targetType', named 'fieldName' at
+// 'path', as per its type, see scrubInternal.
+func scrubTyped(targetValue reflect.Value, targetType reflect.Type, fieldName, path string,
+	state *scrubState) {
+	// The type is checked before the field options, which are looked up at
+	// a greater cost.
+	if targetType.Kind() == reflect.Struct && state.isLeaf(fieldName) {
+		if name, value, ok := nullableValue(targetValue); ok {
+			// Scrub the value held by a nullable wrapper as the field itself,
+			// whether or not it is valid.
+			state.enterJSON(jsonStep{key: name, index: -1})
+			scrubInternal(value.Addr().Interface(), fieldName, fieldPath(path, name), state)
+			state.leaveJSON()
+			return
+		}
+	}
 
-			if !fValue.Addr().CanInterface() {
-				// This is an unexported or private field (begins with lowercase).
-				// We can't take an interface on that or scrub it.
-				// UnsafeAddr(), which is unsafe.Pointer, can be used to workaround it,
-				// but that is not recommended in Golang.
-				continue
+	if isValuer(targetType) && state.isLeaf(fieldName) {
+		// A database value is scrubbed through its driver value, rather than
+		// by its fields.
+		if !state.maskedLeaves[leafOf(targetValue)] {
+			masked := state.masked
+			fieldOpts, _ := state.leafOptions(fieldName)
+			scrubValuer(targetValue, fieldOpts, path, state)
+			if state.masked > masked {
+				state.maskedLeaf(targetValue)
 			}
+		}
+		return
+	}
 
-			scrubInternal(fValue.Addr().Interface(), fType.Name, fieldsToScrub,
-				savedValues, mask)
+	if targetType == timeType && state.isLeaf(fieldName) {
+		// A time is zeroed, or truncated to a coarser value.
+		fieldOpts, _ := state.leafOptions(fieldName)
+		scrubTime(targetValue, fieldOpts, path, state)
+		return
+	}
+
+	if isBinaryMarshaler(targetType) && state.isLeaf(fieldName) {
+		// A value serialized to bytes, such as time.Time, is zeroed through
+		// its binary encoding, rather than scrubbed by its fields.
+		scrubBinary(targetValue, path, state)
+		return
+	}
+
+	if targetType.Kind() == reflect.Interface && targetType != errorType {
+		// If target is an interface (e.g. an element of []interface{}), then
+		// scrub the value held by it. Errors are scrubbed as a whole instead.
+		if targetValue.IsNil() || !targetValue.CanSet() || state.maskedLeaves[leafOf(targetValue)] {
+			return
+		}
+
+		value := targetValue.Elem()
+		if masked, ok := state.maskNumber(value, fieldName, path); ok {
+			// A number held by an interface can be replaced by a string.
+			targetValue.Set(reflect.ValueOf(masked))
+			state.saveRestoreFunc(func() { targetValue.Set(value) })
+			state.maskedLeaf(targetValue)
+			return
+		}
+
+		if scrubbed, ok := scrubCopy(value, fieldName, path, state); ok {
+			targetValue.Set(scrubbed)
+			state.saveRestoreFunc(func() { targetValue.Set(value) })
+			state.maskedLeaf(targetValue)
 		}
 		return
 	}
 
+	if targetType == rawMessageType {
+		// Raw JSON is not a struct, so scrub it without a schema.
+		scrubRawMessage(targetValue, fieldName, path, state)
+		return
+	}
+
+	if state.substitutes && targetType != timeType && isJSONMarshaler(targetType) {
+		// Once scrubbed, scrub what its MarshalJSON method outputs.
+		leaveMarshaler := state.enterMarshaler(targetValue, fieldName, path)
+		scrubKind(targetValue, targetType, fieldName, path, state)
+		leaveMarshaler()
+		return
+	}
+
+	scrubKind(targetValue, targetType, fieldName, path, state)
+}
+
+// scrubKind scrubs 'targetValue' of type 'targetType', named 'fieldName' at
+// 'path', as per its kind, see scrubInternal.
+func scrubKind(targetValue reflect.Value, targetType reflect.Type, fieldName, path string,
+	state *scrubState) {
+	if targetType.Kind() == reflect.Struct {
+		leaveRecord := state.enterRecord(targetValue)
+		leaveSiblings := state.enterSiblings(targetValue)
+		scrubStruct(targetValue, targetType, path, state)
+		leaveSiblings()
+		leaveRecord()
+		return
+	}
+
 	if targetType.Kind() == reflect.Array || targetType.Kind() == reflect.Slice {
-		// If target is an array/slice, then recurse on each of its element.
-		for i := 0; i < targetValue.Len(); i++ {
-			arrValue := targetValue.Index(i)
-			if !arrValue.IsValid() {
-				continue
+		if targetType.Kind() == reflect.Slice && targetValue.Len() > 0 {
+			if !state.enterReference(targetValue) {
+				return
 			}
 
-			if !arrValue.CanAddr() {
-				// Cannot take pointer of this field, so can't scrub it.
-				continue
-			}
+			scrubElements(targetValue, fieldName, path, state)
+			state.leaveReference()
+			return
+		}
 
-			if !arrValue.Addr().CanInterface() {
-				// This is an unexported or private field (begins with lowercase).
-				// We can't take an interface on that or scrub it.
-				// UnsafeAddr(), which is unsafe.Pointer, can be used to workaround it,
-				// but that is not recommended in Golang.
-				continue
-			}
+		scrubElements(targetValue, fieldName, path, state)
+		return
+	}
 
-			scrubInternal(arrValue.Addr().Interface(), fieldName, fieldsToScrub,
-				savedValues, mask)
+	if targetType.Kind() == reflect.Map {
+		if !state.enterReference(targetValue) {
+			return
 		}
 
+		// If target is a map, then scrub its values by their keys.
+		scrubInternalMap(targetValue, path, state)
+		state.leaveReference()
 		return
 	}
 
-	// If 'fieldName' is not set, then the API was not called on a struct.
-	// Since it is not possible to find the variable name of a non-struct field,
-	// we can't compare it with 'fieldsToScrub'.
-	if fieldName == "" {
+	scrubLeaf(targetValue, fieldName, path, state)
+}
+
+// scrubStruct scrubs the fields of the struct 'targetValue' of type
+// 'targetType' at 'path'.
+func scrubStruct(targetValue reflect.Value, targetType reflect.Type, path string,
+	state *scrubState) {
+	// If target is a struct then recurse on each of its field.
+	folded := foldedNames(targetType)
+	tags := structTags(targetType)
+	var jsonFieldsOf []jsonField
+	if state.substitutes {
+		jsonFieldsOf = jsonFields(targetType)
+	}
+	for i := 0; i < targetType.NumField(); i++ {
+		fType := targetType.Field(i)
+		fValue := targetValue.Field(i)
+		if !fValue.IsValid() {
+			continue
+		}
+
+		if !fValue.CanAddr() {
+			// Cannot take pointer of this field, so can't scrub it.
+			continue
+		}
+
+		if !fValue.Addr().CanInterface() {
+			// This is an unexported or private field (begins with lowercase).
+			// We can't take an interface on that or scrub it.
+			// UnsafeAddr(), which is unsafe.Pointer, can be used to workaround it,
+			// but that is not recommended in Golang.
+			continue
+		}
+
+		leave := state.enterTaggedField(fType.Name, tags[i])
+		leaveKey := state.enterKey(fType.Name, true)
+		placed := jsonFieldsOf != nil && state.enterJSONField(jsonFieldsOf[i])
+		state.enterField(fType.Name, folded[i])
+		state.depth++
+		state.names = append(state.names, fType.Name)
+		scrubInternal(fValue.Addr().Interface(), fType.Name,
+			fieldPath(path, fType.Name), state)
+		state.names = state.names[:len(state.names)-1]
+		state.depth--
+		if placed {
+			state.leaveJSON()
+		}
+		leaveKey()
+		leave()
+	}
+}
+
+// scrubElements scrubs the elements of the array or slice 'targetValue',
+// named 'fieldName' at 'path'.
+func scrubElements(targetValue reflect.Value, fieldName, path string, state *scrubState) {
+	// If target is an array/slice, then recurse on each of its element.
+	for i := 0; i < targetValue.Len(); i++ {
+		arrValue := targetValue.Index(i)
+		if !arrValue.IsValid() {
+			continue
+		}
+
+		if !arrValue.CanAddr() {
+			// Cannot take pointer of this field, so can't scrub it.
+			continue
+		}
+
+		if !arrValue.Addr().CanInterface() {
+			// This is an unexported or private field (begins with lowercase).
+			// We can't take an interface on that or scrub it.
+			// UnsafeAddr(), which is unsafe.Pointer, can be used to workaround it,
+			// but that is not recommended in Golang.
+			continue
+		}
+
+		state.enterJSON(jsonStep{index: i})
+		scrubInternal(arrValue.Addr().Interface(), fieldName,
+			indexPath(path, i), state)
+		state.leaveJSON()
+	}
+}
+
+// scrubLeaf scrubs 'targetValue', named 'fieldName' at 'path', which holds
+// no other value to scrub.
+func scrubLeaf(targetValue reflect.Value, fieldName, path string, state *scrubState) {
+	switch targetValue.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Ptr, reflect.Invalid:
+		// Channels, functions, unsafe pointers and pointers left (nil or to
+		// pointers) hold nothing which can be scrubbed.
 		return
 	}
 
-	if _, ok := fieldsToScrub[strings.ToLower(fieldName)]; ok {
-		// Scrub this string value. Other types are not scrubbed.
-		if targetValue.CanSet() && targetValue.Kind() == reflect.String && !targetValue.IsZero() {
-			if mask {
-				// Save the value, so that it can be restored later.
-				*savedValues = append(*savedValues, targetValue.String())
-				targetValue.SetString("********")
-			} else {
-				// Restore from the saved value.
-				targetValue.SetString((*savedValues)[0])
-				*savedValues = (*savedValues)[1:]
+	var fieldOpts FieldScrubOptioner
+	var ok bool
+	if targetValue.Kind() == reflect.String {
+		fieldOpts, ok = state.stringOptions(fieldName, targetValue.String())
+	} else {
+		fieldOpts, ok = state.leafOptions(fieldName)
+	}
+
+	if state.maskedLeaves[leafOf(targetValue)] {
+		// Already masked through another pointer: masking the masked value
+		// again would give another result, e.g. with HashMask.
+		return
+	}
+	masked := state.masked
+
+	if ok {
+		doMasking(targetValue, fieldOpts, path, state)
+	} else if targetValue.Kind() == reflect.String {
+		// Mask the secrets found in this string.
+		scrubMatches(targetValue, fieldName, path, state)
+	}
+
+	if state.masked > masked {
+		state.maskedLeaf(targetValue)
+	}
+}
+
+// scrubInternalMap scrubs the values of the map 'targetValue' at 'path', using
+// the keys of the map as the field names of its values, then masks the keys
+// matching WithKeyMatchers. Only maps with string keys are scrubbed.
+func scrubInternalMap(targetValue reflect.Value, path string, state *scrubState) {
+	if targetValue.Type().Key().Kind() != reflect.String {
+		return
+	}
+	defer state.enterSiblings(targetValue)()
+
+	iter := targetValue.MapRange()
+	for iter.Next() {
+		if !state.countMapEntry() {
+			break
+		}
+
+		key, value := iter.Key(), iter.Value()
+		name, valuePath := key.String(), fieldPath(path, key.String())
+
+		state.depth++
+		state.names = append(state.names, name)
+		leaveKey := state.enterKey(name, false)
+		state.enterJSON(jsonStep{key: name, index: -1})
+		if state.drops(name) {
+			// Delete the entry, which is allowed while iterating.
+			state.report(valuePath, fmt.Sprint(value.Interface()))
+			targetValue.SetMapIndex(key, reflect.Value{})
+			state.saveRestoreFunc(func() { targetValue.SetMapIndex(key, value) })
+		} else if scrubbed, ok := scrubCopy(value, name, valuePath, state); ok {
+			// Map values are not addressable, so a copy of the value is
+			// scrubbed, and stored back into the map if anything in it was
+			// scrubbed.
+			targetValue.SetMapIndex(key, scrubbed)
+			state.saveRestoreFunc(func() { targetValue.SetMapIndex(key, value) })
+		}
+		state.leaveJSON()
+		leaveKey()
+		state.names = state.names[:len(state.names)-1]
+		state.depth--
+	}
+
+	// Keys are masked once the values were scrubbed by their original keys.
+	scrubKeys(targetValue, path, state)
+}
+
+// scrubCopy scrubs a copy of the non-addressable 'value' (such as a map value
+// or the value held by an interface) named 'fieldName' at 'path', and returns
+// the scrubbed copy. It returns false if nothing was scrubbed in the copy.
+// Values referring to other values, such as slices and pointers, share them
+// with their copies, so those are scrubbed in place.
+func scrubCopy(value reflect.Value, fieldName, path string,
+	state *scrubState) (reflect.Value, bool) {
+	valueCopy := reflect.New(value.Type())
+	valueCopy.Elem().Set(value)
+
+	scrubbed := len(state.restoreFuncs)
+	scrubInternal(valueCopy.Interface(), fieldName, path, state)
+
+	return valueCopy.Elem(), len(state.restoreFuncs) > scrubbed
+}
+
+// doMasking masks the given 'targetValue' at 'path' as per the field options
+// 'fieldOpts' and the call options, and saves a function to restore its
+// original value in 'state'. See scrubInternal for the details.
+func doMasking(targetValue reflect.Value, fieldOpts FieldScrubOptioner, path string,
+	state *scrubState) {
+	if !targetValue.CanSet() || targetValue.IsZero() {
+		return
+	}
+
+	if targetValue.Type() == errorType {
+		// Scrub the message of this error and of the errors wrapped by it.
+		original := targetValue.Interface().(error)
+		state.saveRestoreFunc(func() { targetValue.Set(reflect.ValueOf(original)) })
+		state.report(path, original.Error())
+
+		targetValue.Set(reflect.ValueOf(scrubError(original, fieldOpts, path, state)))
+		return
+	}
+
+	if isNonString(targetValue.Kind()) {
+		// Zero this number or boolean value, if requested.
+		if !fieldOptions(fieldOpts).ScrubNonString {
+			return
+		}
+
+		original := reflect.New(targetValue.Type()).Elem()
+		original.Set(targetValue)
+		state.saveRestoreFunc(func() { targetValue.Set(original) })
+		state.report(path, fmt.Sprint(original.Interface()))
+
+		targetValue.Set(reflect.Zero(targetValue.Type()))
+		return
+	}
+
+	// Scrub this string value. Other types are not scrubbed.
+	if targetValue.Kind() != reflect.String {
+		return
+	}
+
+	// Save the value, so that it can be restored later.
+	original := targetValue.String()
+	state.saveRestoreFunc(func() { targetValue.SetString(original) })
+	state.report(path, original)
+
+	if fieldOptions(fieldOpts).Drop {
+		targetValue.SetString("")
+		return
+	}
+
+	targetValue.SetString(maskValue(original, fieldOpts, path, state))
+}
+
+// isNonString returns true for the kinds of numbers and booleans, which are
+// scrubbed with FieldScrubOptions.ScrubNonString.
+func isNonString(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+
+	return false
+}
+
+// maskNumber returns the number 'value' named 'fieldName' at 'path' as a
+// string with its digits masked, if its field is scrubbed with
+// FieldScrubOptions.PreserveNumberFormat, or false otherwise.
+func (s *scrubState) maskNumber(value reflect.Value, fieldName, path string) (string, bool) {
+	fieldOpts, ok := s.leafOptions(fieldName)
+	if !ok {
+		return "", false
+	}
+
+	o := fieldOptions(fieldOpts)
+	if !o.ScrubNonString || !o.PreserveNumberFormat {
+		return "", false
+	}
+
+	var number string
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number = strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		number = strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		number = strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits())
+	default:
+		return "", false
+	}
+
+	s.report(path, number)
+	return maskDigits(number, fieldOpts, s.opts), true
+}
+
+// maskDigits returns the formatted number 'number' with each of its digits
+// replaced by the symbol of 'fieldOpts', or of 'opts' if it has none.
+func maskDigits(number string, fieldOpts FieldScrubOptioner, opts *options) string {
+	symbol := fieldOptions(fieldOpts).Symbol
+	if symbol == "" {
+		symbol = MaskFull(opts.maskSymbol, 1)
+	}
+
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteString(symbol)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// maskValue returns the masked form of a sensitive 'value' at 'path' as per
+// the field options 'fieldOpts' and the options of 'state'. If the value
+// can't be masked partially as requested, it is masked fully and the
+// fallback is reported, see WithPartialFallback.
+func maskValue(value string, fieldOpts FieldScrubOptioner, path string,
+	state *scrubState) string {
+	o, opts := fieldOptions(fieldOpts), state.opts
+	if o.Token != "" {
+		return o.Token
+	}
+
+	symbol := opts.maskSymbol
+	if o.Symbol != "" {
+		symbol = o.Symbol
+	}
+
+	runes := []rune(value)
+	if o.Strategy != nil {
+		strategy := o.Strategy
+		if o.KeyByPath && o.keyedStrategy != nil {
+			strategy = o.keyedStrategy(state.fieldKey)
+		}
+
+		if masked, ok := strategy(value); ok {
+			return masked
+		}
+
+		opts.reportFallback(path, len(runes))
+		return opts.fallbackMask(symbol, len(runes))
+	}
+
+	// Keep the first and last few characters visible, unless that reveals
+	// too much of a short value.
+	first, last := opts.alwaysShowFirst, opts.alwaysShowLast
+	if o.ShowFirst > 0 || o.ShowLast > 0 {
+		first, last = o.ShowFirst, o.ShowLast
+	}
+
+	if first < 0 {
+		first = 0
+	}
+
+	if last < 0 {
+		last = 0
+	}
+
+	if n := first + last; n > 0 {
+		if len(runes) > 2*n {
+			return string(runes[:first]) + opts.mask(symbol, len(runes)-n) +
+				string(runes[len(runes)-last:])
+		}
+
+		opts.reportFallback(path, len(runes))
+		return opts.fallbackMask(symbol, len(runes))
+	}
+
+	return opts.mask(symbol, len(runes))
+}
+
+// fieldPath returns the path of the field 'name' of the struct at 'path'.
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// indexPath returns the path of the element 'i' of the array or slice at 'path'.
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// defaultFieldOptions converts a set of field names to scrub to a map of
+// fields to scrub with the default options.
+func defaultFieldOptions(fieldsToScrub map[string]bool) map[string]FieldScrubOptioner {
+	fields := make(map[string]FieldScrubOptioner, len(fieldsToScrub))
+	for name := range fieldsToScrub {
+		fields[name] = nil
+	}
+
+	return fields
+}
+
+// resolveFields returns the effective fields to scrub, which are the given
+// 'fieldsToScrub' plus the members of any FieldGroups they specify, minus
+// the fields excluded by 'opts'. The given map is not modified.
+func resolveFields(fieldsToScrub map[string]FieldScrubOptioner,
+	opts *options) map[string]FieldScrubOptioner {
+	given := make(map[string]FieldScrubOptioner, len(fieldsToScrub))
+	for name, fieldOpts := range fieldsToScrub {
+		given[opts.fold(name)] = fieldOpts
+	}
+
+	fields := make(map[string]FieldScrubOptioner, len(given))
+	for name, fieldOpts := range given {
+		fields[name] = fieldOpts
+	}
+
+	for group, members := range FieldGroups {
+		fieldOpts, ok := given[opts.fold(group)]
+		for i := 0; !ok && i < len(members); i++ {
+			fieldOpts, ok = given[opts.fold(members[i])]
+		}
+
+		if !ok {
+			continue
+		}
+
+		for _, member := range members {
+			if _, ok := fields[opts.fold(member)]; !ok {
+				fields[opts.fold(member)] = fieldOpts
 			}
 		}
 	}
+
+	for name := range opts.excludedFields {
+		delete(fields, name)
+	}
+
+	return fields
+}
+
+// foldedFieldNames caches the case folded names of the fields of the struct
+// types scrubbed, see foldedNames.
+var foldedFieldNames sync.Map
+
+// foldedNames returns the case folded names of the fields of the struct type
+// 'structType', by field index. They are computed once per type, to spare
+// folding the names of the fields every time they are scrubbed.
+func foldedNames(structType reflect.Type) []string {
+	if names, ok := foldedFieldNames.Load(structType); ok {
+		return names.([]string)
+	}
+
+	names := make([]string, structType.NumField())
+	for i := range names {
+		names[i] = foldName(structType.Field(i).Name)
+	}
+	foldedFieldNames.Store(structType, names)
+
+	return names
+}
+
+// foldName returns the case folded form of the field name 'name', used to
+// compare field names case insensitively. Besides lowercasing, it applies the
+// full Unicode case folding, so that e.g. "STRASSE" and "Straße" match.
+func foldName(name string) string {
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return cases.Fold().String(strings.ToLower(name))
+		}
+	}
+
+	// Folding ASCII is just lowercasing.
+	return strings.ToLower(name)
+}
+
+// fieldOptions returns the scrubbing options given by 'opts', falling back
+// to the default options if 'opts' is nil or doesn't provide any.
+func fieldOptions(opts FieldScrubOptioner) *FieldScrubOptions {
+	if opts != nil {
+		if o := opts.ScrubOptions(); o != nil {
+			return o
+		}
+	}
+
+	return &FieldScrubOptions{}
 }
@@ -1,8 +1,19 @@
 package scrub
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"unicode/utf8"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -22,6 +33,88 @@ type Users struct {
 	UserInfo []User
 }
 
+// Struct with a secret split across nested fields
+type APIKey struct {
+	KeyPart1 string
+	KeyPart2 string
+}
+
+type Service struct {
+	Name     string
+	KeyPart0 string
+	Key      APIKey
+}
+
+// Struct with a type whose fields are never sensitive
+type PublicKey struct {
+	Secret string
+}
+
+type KeyPair struct {
+	Secret string
+	Public PublicKey
+	Peers  []*PublicKey
+}
+
+// Struct with header maps
+type Message struct {
+	HTTP http.Header
+	MIME textproto.MIMEHeader
+}
+
+// Struct with generic records
+type Records struct {
+	Records []interface{}
+}
+
+// Struct with a map of pointers to structs
+type Directory struct {
+	Users map[string]*User
+}
+
+// Struct with a slice of generic maps
+type Events struct {
+	Events []map[string]interface{}
+}
+
+// Struct with maps of strings
+type Form struct {
+	Fields map[string]string
+	Parts  []interface{}
+}
+
+// Struct with a record-level redaction switch
+type Record struct {
+	ID           string
+	Owner        string
+	Notes        []string
+	Confidential bool
+}
+
+// Struct with numeric and boolean fields
+type BankAccount struct {
+	Holder        string
+	SSN           int
+	AccountNumber uint64
+	Balance       float64
+	Overdrawn     bool
+	Limits        []int32
+}
+
+// Struct with a sensitive sub-struct
+type Credentials struct {
+	Login  string
+	Secret string
+	Hosts  []string
+}
+
+type Account struct {
+	Name        string
+	Credentials Credentials
+	Extra       map[string]interface{}
+	Raw         json.RawMessage
+}
+
 // TestScrubSimple tests scrubbing on a simple struct with default
 // sensitive fields.
 func TestScrubSimple(t *testing.T) {
@@ -107,6 +200,20 @@ func TestScrubNil(t *testing.T) {
 	validateScrub(t, nil, nil, nil)
 }
 
+// TestScrubZero tests that zero-valued targets are scrubbed like any other.
+func TestScrubZero(t *testing.T) {
+	want := `{"Username":"","Password":"","DbSecrets":null}`
+
+	assert.Equal(t, want, Scrub(&User{}, nil))
+	assert.Equal(t, want, ScrubValue(User{}, nil))
+
+	got, err := ScrubE(&User{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	assert.NoError(t, ScrubStruct(&User{}, nil))
+}
+
 // TestScrubNestedNil tests scrubbing on a nested complex struct with
 // some nil, empty and specified sensitive fields.
 func TestScrubNestedNil(t *testing.T) {
@@ -150,18 +257,1701 @@ func TestScrubNestedNil(t *testing.T) {
 	validateScrub(t, users, userScrubbed, secretFields)
 }
 
-// validateScrub is a helper function to validate scrubbing functionality on a struct.
-func validateScrub(t *testing.T, msg, scrubbedMsg interface{}, secretFields map[string]bool) {
-	t.Helper()
+// TestScrubFieldTokens tests scrubbing with a constant masking token per field.
+func TestScrubFieldTokens(t *testing.T) {
+	users := &Users{
+		Secret: "secret_sshhh",
+		Keys:   []string{"key_1", "key_2"},
+		UserInfo: []User{
+			{
+				Username:  "John Doe",
+				Password:  "John_Doe's_Password",
+				DbSecrets: []string{"John's_db_secret_1"},
+			},
+		},
+	}
+
+	userScrubbed := &Users{
+		Secret: "********",
+		Keys:   []string{"<key>", "<key>"},
+		UserInfo: []User{
+			{
+				Username:  "John Doe",
+				Password:  "<pw>",
+				DbSecrets: []string{"John's_db_secret_1"},
+			},
+		},
+	}
 
-	// Get the scrubbed string from util API.
-	got := Scrub(msg, secretFields)
+	secretFields := map[string]FieldScrubOptioner{
+		"password": &FieldScrubOptions{Token: "<pw>"},
+		"keys":     &FieldScrubOptions{Token: "<key>"},
+		"secret":   nil,
+	}
+	validateScrubFields(t, users, userScrubbed, secretFields)
 
-	// Compare it against the given scrubbed representaation.
-	var b []byte
-	b, _ = json.Marshal(scrubbedMsg)
-	want := string(b)
+	// The original struct must be restored after scrubbing.
+	assert.Equal(t, "John_Doe's_Password", users.UserInfo[0].Password)
+	assert.Equal(t, []string{"key_1", "key_2"}, users.Keys)
+}
 
-	assert.Equal(t, want, got,
-		"JSON representation mismatch after scrubbing sensitive fields")
+// TestScrubMultiCharacterTokens tests replacing whole values with multi-character tokens.
+func TestScrubMultiCharacterTokens(t *testing.T) {
+	user := &User{
+		Username:  "John Doe",
+		Password:  "pw",
+		DbSecrets: []string{"a_very_long_database_secret"},
+	}
+
+	userScrubbed := &User{
+		Username:  "John Doe",
+		Password:  "[REDACTED]",
+		DbSecrets: []string{"***hidden***"},
+	}
+
+	want, _ := json.Marshal(userScrubbed)
+	got := ScrubFields(user, map[string]FieldScrubOptioner{
+		"password":  NewMask().Token("[REDACTED]"),
+		"dbsecrets": NewMask().Token("***hidden***"),
+	}, WithAlwaysShowFirst(2))
+	assert.Equal(t, string(want), got)
+}
+
+// TestScrubFieldGroups tests scrubbing all the members of a field group.
+func TestScrubFieldGroups(t *testing.T) {
+	FieldGroups["apikey"] = []string{"keypart0", "keypart1", "keypart2"}
+	defer delete(FieldGroups, "apikey")
+
+	svc := &Service{
+		Name:     "billing",
+		KeyPart0: "AKIA",
+		Key:      APIKey{KeyPart1: "IOSFODNN7", KeyPart2: "EXAMPLE"},
+	}
+
+	// Configuring the group name masks all members with its options.
+	svcScrubbed := &Service{
+		Name:     "billing",
+		KeyPart0: "<key>",
+		Key:      APIKey{KeyPart1: "<key>", KeyPart2: "<key>"},
+	}
+	validateScrubFields(t, svc, svcScrubbed, map[string]FieldScrubOptioner{
+		"apikey": &FieldScrubOptions{Token: "<key>"},
+	})
+
+	// Configuring any member masks all members with its options.
+	svcScrubbed = &Service{
+		Name:     "billing",
+		KeyPart0: "********",
+		Key:      APIKey{KeyPart1: "********", KeyPart2: "********"},
+	}
+	validateScrub(t, svc, svcScrubbed, map[string]bool{"keypart2": true})
+
+	// Members configured explicitly keep their own options.
+	svcScrubbed = &Service{
+		Name:     "billing",
+		KeyPart0: "<key>",
+		Key:      APIKey{KeyPart1: "<part1>", KeyPart2: "<key>"},
+	}
+	validateScrubFields(t, svc, svcScrubbed, map[string]FieldScrubOptioner{
+		"apikey":   &FieldScrubOptions{Token: "<key>"},
+		"keypart1": &FieldScrubOptions{Token: "<part1>"},
+	})
+}
+
+// TestScrubExcludedFields tests excluding fields from scrubbing for a single call.
+func TestScrubExcludedFields(t *testing.T) {
+	user := &User{
+		Username:  "Shyam Rathi",
+		Password:  "nutanix/4u",
+		DbSecrets: []string{"db_secret_1"},
+	}
+
+	// 'password' is excluded from the default fields for this call only.
+	got := Scrub(user, nil, WithExcludedFields("Password"))
+	b, _ := json.Marshal(user)
+	assert.Equal(t, string(b), got)
+
+	userScrubbed := &User{
+		Username:  "Shyam Rathi",
+		Password:  "********",
+		DbSecrets: []string{"db_secret_1"},
+	}
+	validateScrub(t, user, userScrubbed, nil)
+
+	// Excluded fields are subtracted from explicit fields too.
+	userScrubbed = &User{
+		Username:  "Shyam Rathi",
+		Password:  "nutanix/4u",
+		DbSecrets: []string{"********"},
+	}
+	got = Scrub(user, map[string]bool{"password": true, "dbsecrets": true},
+		WithExcludedFields("password"))
+	b, _ = json.Marshal(userScrubbed)
+	assert.Equal(t, string(b), got)
+}
+
+// TestScrubAlwaysShowFirst tests keeping the first characters of scrubbed values visible.
+func TestScrubAlwaysShowFirst(t *testing.T) {
+	users := &Users{
+		Secret: "secret_sshhh",
+		Keys:   []string{"key_1", "k2"},
+		UserInfo: []User{
+			{
+				Username:  "John Doe",
+				Password:  "John_Doe's_Password",
+				DbSecrets: []string{"John's_db_secret_1"},
+			},
+		},
+	}
+
+	userScrubbed := &Users{
+		Secret: "sec********",
+		Keys:   []string{"********", "********"},
+		UserInfo: []User{
+			{
+				Username:  "John Doe",
+				Password:  "<pw>",
+				DbSecrets: []string{"Joh********"},
+			},
+		},
+	}
+
+	// Short values are masked fully, and tokens replace values fully.
+	secretFields := map[string]FieldScrubOptioner{
+		"password":  &FieldScrubOptions{Token: "<pw>"},
+		"keys":      nil,
+		"secret":    nil,
+		"dbsecrets": &FieldScrubOptions{},
+	}
+
+	got := ScrubFields(users, secretFields, WithAlwaysShowFirst(3))
+	b, _ := json.Marshal(userScrubbed)
+	assert.Equal(t, string(b), got)
+}
+
+// TestScrubPartialFallback tests reporting values masked fully instead of partially.
+func TestScrubPartialFallback(t *testing.T) {
+	fallbacks := make(map[string]int)
+	onFallback := func(path string, valueLen int) {
+		fallbacks[path] = valueLen
+	}
+
+	users := &Users{
+		Secret: "aGVhZGVy.cGF5bG9hZA.c2ln",
+		Keys:   []string{"k1", "not.a.jwt!"},
+		UserInfo: []User{
+			{Username: "jdoe", Password: "short"},
+			{Username: "jroe", Password: "long_enough_password"},
+		},
+	}
+
+	got := ScrubFields(users, map[string]FieldScrubOptioner{
+		"password": nil,
+		"secret":   NewMask().Strategy(JWTSignatureMask),
+		"keys":     NewMask().Strategy(JWTSignatureMask),
+	}, WithAlwaysShowFirst(3), WithPartialFallback(onFallback))
+
+	assert.NotContains(t, got, "short")
+	assert.Equal(t, map[string]int{
+		"Keys[0]":              2,
+		"Keys[1]":              10,
+		"UserInfo[0].Password": 5,
+	}, fallbacks)
+}
+
+// TestScrubAlwaysShowFirstUTF8 tests that visible characters are counted in
+// runes, so that multi-byte characters are never cut.
+func TestScrubAlwaysShowFirstUTF8(t *testing.T) {
+	for value, want := range map[string]string{
+		"José García 12345": "Jos********",
+		"éàü🔑🔑🔑🔑":           "éàü********",
+		"😀😀😀😀😀😀😀":           "😀😀😀********",
+		"ñañaña":            "********",
+	} {
+		user := &User{Password: value}
+		got := Scrub(user, nil, WithAlwaysShowFirst(3))
+		b, _ := json.Marshal(&User{Password: want})
+		assert.Equal(t, string(b), got, "value %q", value)
+		assert.True(t, utf8.ValidString(got))
+	}
+}
+
+// TestScrubAlwaysShowFirstShort tests that short values are masked fully
+// instead of having their visible characters cover most of the value.
+func TestScrubAlwaysShowFirstShort(t *testing.T) {
+	for value, want := range map[string]string{
+		"abcdef":    "********",
+		"abcdefgh":  "********",
+		"abcdefghi": "abcd********",
+	} {
+		user := &User{Password: value}
+		got := Scrub(user, nil, WithAlwaysShowFirst(4))
+		b, _ := json.Marshal(&User{Password: want})
+		assert.Equal(t, string(b), got, "value %q", value)
+	}
+}
+
+// TestScrubAlwaysShowLast tests keeping the last characters of scrubbed
+// values visible, alone or with the first ones.
+func TestScrubAlwaysShowLast(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		opts  []Option
+		want  string
+	}{
+		{"4111111111115678", []Option{WithAlwaysShowLast(4)}, "********5678"},
+		{"4111111111115678", []Option{WithAlwaysShowLast(4), WithMaskLenVary(true)},
+			"************5678"},
+		{"12345678", []Option{WithAlwaysShowLast(4)}, "********"},
+		{"123456789", []Option{WithAlwaysShowLast(4)}, "********6789"},
+		{"电话号码一二三四五", []Option{WithAlwaysShowLast(2)}, "********四五"},
+		{"4111111111115678", []Option{WithAlwaysShowFirst(2), WithAlwaysShowLast(4)},
+			"41********5678"},
+		{"41111111115678", []Option{WithAlwaysShowFirst(2), WithAlwaysShowLast(4),
+			WithMaskLenVary(true)}, "41********5678"},
+		{"411111115678", []Option{WithAlwaysShowFirst(2), WithAlwaysShowLast(4)},
+			"********"},
+	} {
+		user := &User{Password: tc.value}
+		got := Scrub(user, nil, tc.opts...)
+		b, _ := json.Marshal(&User{Password: tc.want})
+		assert.Equal(t, string(b), got, "value %q", tc.value)
+	}
+}
+
+// TestScrubMaskLenVary tests masks as long as the masked values.
+func TestScrubMaskLenVary(t *testing.T) {
+	for _, tc := range []struct {
+		opts []Option
+		want string
+	}{
+		{[]Option{WithMaskLenVary(true)}, "*******"},
+		{[]Option{WithMaskLenVary(true), WithDefaultSymbol("#")}, "#######"},
+		{[]Option{WithMaskLenVary(true), WithAlwaysShowFirst(2)}, "hu*****"},
+		{[]Option{WithMaskLenVary(false), WithDefaultSymbol("x")}, "xxxxxxxx"},
+		{[]Option{WithDefaultSymbol("█"), WithAlwaysShowFirst(2)}, "hu████████"},
+		{[]Option{WithMaskLen(12)}, "************"},
+		{[]Option{WithMaskLen(4), WithAlwaysShowFirst(2)}, "hu****"},
+		{[]Option{WithMaskLen(4), WithMaskLenVary(true)}, "*******"},
+		{[]Option{WithMaskLen(-1)}, "********"},
+	} {
+		user := &User{Username: "John Doe", Password: "hunter2"}
+		b, _ := json.Marshal(&User{Username: "John Doe", Password: tc.want})
+		assert.Equal(t, string(b), Scrub(user, nil, tc.opts...))
+	}
+
+	// Tokens are not affected.
+	user := &User{Password: "hunter2"}
+	got := ScrubFields(user, map[string]FieldScrubOptioner{"password": NewMask().Token("[pw]")},
+		WithMaskLenVary(true), WithDefaultSymbol("#"))
+	assert.Contains(t, got, `"Password":"[pw]"`)
+}
+
+// TestScrubMultiByteSymbol tests masks made of a multi-byte symbol.
+func TestScrubMultiByteSymbol(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		opts  []Option
+		want  string
+	}{
+		{"hunter2", nil, "••••••••"},
+		{"hunter2", []Option{WithMaskLenVary(true)}, "•••••••"},
+		{"пароль", []Option{WithMaskLenVary(true)}, "••••••"},
+		{"пароль12", []Option{WithMaskLenVary(true), WithAlwaysShowFirst(1),
+			WithAlwaysShowLast(2)}, "п•••••12"},
+		{"hunter2", []Option{WithMaskLen(3)}, "•••"},
+	} {
+		user := &User{Password: tc.value}
+		opts := append([]Option{WithDefaultSymbol("•")}, tc.opts...)
+		b, _ := json.Marshal(&User{Password: tc.want})
+		assert.Equal(t, string(b), Scrub(user, nil, opts...), "value %q", tc.value)
+	}
+}
+
+// TestScrubFixedLenFallback tests hiding the lengths of values which can't be
+// masked partially.
+func TestScrubFixedLenFallback(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		opts  []Option
+		want  string
+	}{
+		// Too short to show the first characters.
+		{"hunter", []Option{WithMaskLenVary(true)}, "******"},
+		{"hunter", []Option{WithMaskLenVary(true), WithFixedLenFallback(true)}, "********"},
+		{"hunter", []Option{WithFixedLenFallback(true)}, "********"},
+		{"hunter", []Option{WithMaskLenVary(true), WithFixedLenFallback(true), WithMaskLen(5)},
+			"*****"},
+		// Long enough to show them.
+		{"hunter2", []Option{WithMaskLenVary(true), WithFixedLenFallback(true)}, "hun****"},
+		{"a_very_long_password", []Option{WithMaskLenVary(true), WithFixedLenFallback(true)},
+			"a_v*****************"},
+	} {
+		user := &User{Password: tc.value}
+		got := Scrub(user, nil, append(tc.opts, WithAlwaysShowFirst(3))...)
+		b, _ := json.Marshal(&User{Password: tc.want})
+		assert.Equal(t, string(b), got, "value %q", tc.value)
+	}
+
+	// Values a strategy can't handle.
+	for fixed, want := range map[bool]string{false: "*********", true: "********"} {
+		session := &Session{Token: "not-a-jwt"}
+		got := ScrubFields(session, map[string]FieldScrubOptioner{
+			"token": NewMask().Strategy(JWTSignatureMask),
+		}, WithMaskLenVary(true), WithFixedLenFallback(fixed))
+		assert.Contains(t, got, `"Token":"`+want+`"`)
+	}
+}
+
+// TestScrubCaseSensitiveFields tests comparing field names case sensitively.
+func TestScrubCaseSensitiveFields(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "hunter2", DbSecrets: []string{"secret"}}
+
+	got := Scrub(user, map[string]bool{"password": true, "DbSecrets": true},
+		WithCaseSensitiveFields(true))
+	b, _ := json.Marshal(&User{Username: "John Doe", Password: "hunter2", DbSecrets: []string{"********"}})
+	assert.Equal(t, string(b), got)
+
+	got = Scrub(user, map[string]bool{"Password": true, "DbSecrets": true},
+		WithCaseSensitiveFields(true), WithExcludedFields("dbsecrets"))
+	b, _ = json.Marshal(&User{Username: "John Doe", Password: "********", DbSecrets: []string{"********"}})
+	assert.Equal(t, string(b), got)
+}
+
+// TestScrubCaseSensitiveMapKeys tests telling map keys apart by their case.
+func TestScrubCaseSensitiveMapKeys(t *testing.T) {
+	events := &Events{
+		Events: []map[string]interface{}{
+			{"Id": "public_id", "ID": "secret_id", "Password": "a", "password": "b"},
+		},
+	}
+
+	eventsScrubbed := &Events{
+		Events: []map[string]interface{}{
+			{"Id": "public_id", "ID": "********", "Password": "********", "password": "b"},
+		},
+	}
+
+	want, _ := json.Marshal(eventsScrubbed)
+	got := Scrub(events, map[string]bool{"ID": true, "Password": true}, WithCaseSensitiveFields(true))
+	assert.Equal(t, string(want), got)
+
+	// Field names are case insensitive by default.
+	got = Scrub(events, map[string]bool{"ID": true, "Password": true})
+	assert.NotContains(t, got, "public_id")
+	assert.NotContains(t, got, `"password":"b"`)
+}
+
+// TestScrubEnvironment tests masking fields in some environments only.
+func TestScrubEnvironment(t *testing.T) {
+	fields := map[string]FieldScrubOptioner{
+		"username": NewMask().MaskInEnvs("prod", "staging"),
+		"password": NewMask().RevealInEnvs("dev"),
+	}
+
+	for env, want := range map[string]*User{
+		"dev":     {Username: "John Doe", Password: "hunter2"},
+		"staging": {Username: "********", Password: "********"},
+		"prod":    {Username: "********", Password: "********"},
+		"":        {Username: "John Doe", Password: "********"},
+	} {
+		user := &User{Username: "John Doe", Password: "hunter2"}
+		got := ScrubFields(user, fields, WithEnvironment(env))
+
+		b, _ := json.Marshal(want)
+		assert.Equal(t, string(b), got, env)
+	}
+}
+
+// Sensitive is a marker interface of sensitive types.
+type Sensitive interface {
+	sensitive()
+}
+
+// AccessKey is a sensitive string.
+type AccessKey string
+
+func (AccessKey) sensitive() {}
+
+// Login is a sensitive struct.
+type Login struct {
+	User string
+	Pass string
+}
+
+func (*Login) sensitive() {}
+
+// Struct with fields of sensitive types
+type Integration struct {
+	Name    string
+	Primary AccessKey
+	Login   Login
+	Backup  *Login
+	Extra   Sensitive
+	Keys    map[string]AccessKey
+}
+
+// TestScrubSecretInterfaces tests masking the values of types implementing
+// an interface, whatever their names.
+func TestScrubSecretInterfaces(t *testing.T) {
+	integration := &Integration{
+		Name:    "billing",
+		Primary: "key_1",
+		Login:   Login{User: "john", Pass: "hunter2"},
+		Backup:  &Login{User: "jane", Pass: "hunter3"},
+		Extra:   AccessKey("key_2"),
+		Keys:    map[string]AccessKey{"old": "key_3"},
+	}
+
+	integrationScrubbed := &Integration{
+		Name:    "billing",
+		Primary: "********",
+		Login:   Login{User: "********", Pass: "********"},
+		Backup:  &Login{User: "********", Pass: "********"},
+		Extra:   AccessKey("********"),
+		Keys:    map[string]AccessKey{"old": "********"},
+	}
+
+	validateScrubFields(t, integration, integrationScrubbed, map[string]FieldScrubOptioner{},
+		WithSecretInterfaces(reflect.TypeOf((*Sensitive)(nil)).Elem()))
+
+	err := NewScrubber(nil, WithSecretInterfaces(reflect.TypeOf(""), nil)).Validate()
+	assert.EqualError(t, err, "scrub: invalid config: "+
+		"secret type string is not an interface; secret type <nil> is not an interface")
+}
+
+// TestScrubDefaultFields tests setting the fields to scrub if none are given.
+func TestScrubDefaultFields(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "hunter2"}
+
+	got := ScrubFields(user, nil, WithDefaultFields(map[string]FieldScrubOptioner{"username": nil}))
+	b, _ := json.Marshal(&User{Username: "********", Password: "hunter2"})
+	assert.Equal(t, string(b), got)
+
+	// Given fields take precedence.
+	got = ScrubFields(user, map[string]FieldScrubOptioner{},
+		WithDefaultFields(map[string]FieldScrubOptioner{"username": nil}))
+	b, _ = json.Marshal(user)
+	assert.Equal(t, string(b), got)
+}
+
+// TestRegisterDefaultField tests extending the fields scrubbed by default.
+func TestRegisterDefaultField(t *testing.T) {
+	RegisterDefaultField("username", NewMask().Token("<user>"))
+	defer delete(DefaultToScrub, "username")
+	defer delete(defaultFieldOpts, "username")
+
+	fields := DefaultFields()
+	assert.Len(t, fields, 2)
+	assert.Nil(t, fields["password"])
+	assert.Equal(t, "<user>", fieldOptions(fields["username"]).Token)
+
+	// The returned fields are a copy.
+	fields["token"] = nil
+	assert.NotContains(t, DefaultFields(), "token")
+
+	user := &User{Username: "John Doe", Password: "hunter2"}
+	b, _ := json.Marshal(&User{Username: "<user>", Password: "********"})
+	assert.Equal(t, string(b), Scrub(user, nil))
+}
+
+// TestScrubWithOptions tests scrubbing in a given data type with options.
+func TestScrubWithOptions(t *testing.T) {
+	user := User{Username: "John Doe", Password: "hunter2"}
+
+	got, err := ScrubWithOptions(user, nil, YAMLScrub, WithMaskLenVary(true))
+	assert.NoError(t, err)
+	assert.YAMLEq(t, "username: John Doe\npassword: '*******'\ndbsecrets: []\n", got)
+
+	_, err = ScrubWithOptions(&user, nil, "toml")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+// TestScrubAndWrite tests appending scrubbed values to a buffer.
+func TestScrubAndWrite(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "hunter2"}
+
+	var buf bytes.Buffer
+	buf.WriteString("user=")
+	assert.NoError(t, ScrubAndWrite(&buf, user, nil))
+	assert.Equal(t, `user={"Username":"John Doe","Password":"********","DbSecrets":null}`,
+		buf.String())
+	assert.Equal(t, "hunter2", user.Password)
+
+	// The buffer is left as it was on error.
+	err := ScrubAndWrite(&buf, map[string]interface{}{"c": make(chan int)}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, `user={"Username":"John Doe","Password":"********","DbSecrets":null}`,
+		buf.String())
+
+	buf.Reset()
+	assert.NoError(t, ScrubAndWrite(&buf, user, nil, WithDataType(YAMLScrub)))
+	assert.YAMLEq(t, "username: John Doe\npassword: '********'\ndbsecrets: []\n", buf.String())
+}
+
+// failingWriter is an io.Writer which always fails.
+type failingWriter struct{}
+
+// Write implements io.Writer.
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// TestScrubTo tests writing scrubbed values to an io.Writer.
+func TestScrubTo(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "hunter2"}
+
+	var out strings.Builder
+	assert.NoError(t, ScrubTo(&out, user, nil))
+	assert.NoError(t, ScrubTo(&out, *user, nil, WithDataType(YAMLScrub)))
+	assert.Equal(t, `{"Username":"John Doe","Password":"********","DbSecrets":null}`+"\n"+
+		"username: John Doe\npassword: '********'\ndbsecrets: []\n", out.String())
+	assert.Equal(t, "hunter2", user.Password)
+
+	err := ScrubTo(failingWriter{}, user, nil)
+	assert.EqualError(t, err, "scrub: marshal: disk full")
+	assert.Equal(t, "hunter2", user.Password)
+}
+
+// TestScrubSlice tests scrubbing a slice of structs without wrapping it in a struct.
+func TestScrubSlice(t *testing.T) {
+	users := []User{
+		{Username: "John Doe", Password: "John_Doe's_Password"},
+		{Username: "Jane Doe", Password: "Jane_Doe's_Password"},
+	}
+
+	usersScrubbed := []User{
+		{Username: "John Doe", Password: "********"},
+		{Username: "Jane Doe", Password: "********"},
+	}
+
+	want, _ := json.Marshal(usersScrubbed)
+
+	got, err := ScrubSlice(&users, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), got)
+	assert.Equal(t, "John_Doe's_Password", users[0].Password)
+
+	// Slice of pointers, with a nil element.
+	userPtrs := []*User{&users[0], nil, &users[1]}
+	want, _ = json.Marshal([]*User{&usersScrubbed[0], nil, &usersScrubbed[1]})
+
+	got, err = ScrubSlice(&userPtrs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), got)
+
+	// Invalid inputs.
+	var nilUsers *[]User
+	for _, target := range []interface{}{users, nilUsers, &users[0], nil} {
+		_, err = ScrubSlice(target, nil)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+	}
+}
+
+// TestScrubSliceOfMaps tests scrubbing a list of records held by maps,
+// without wrapping it in a struct.
+func TestScrubSliceOfMaps(t *testing.T) {
+	records := []map[string]interface{}{
+		{"username": "John Doe", "password": "hunter2"},
+		{"username": "Jane Doe", "password": "hunter3", "tags": []interface{}{"admin"}},
+	}
+
+	want := `[{"password":"********","username":"John Doe"},` +
+		`{"password":"********","tags":["admin"],"username":"Jane Doe"}]`
+	validateScrub(t, records, json.RawMessage(want), nil)
+
+	got, err := ScrubSlice(&records, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	labels := []map[string]string{{"name": "db", "password": "hunter4"}}
+	validateScrub(t, &labels, json.RawMessage(`[{"name":"db","password":"********"}]`), nil)
+}
+
+// TestScrubContext tests stopping the scrubbing when a context is done.
+func TestScrubContext(t *testing.T) {
+	users := &Users{
+		UserInfo: []User{{Username: "John Doe", Password: "hunter2"}},
+	}
+
+	got, err := ScrubContext(context.Background(), users, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, got, `"Password":"********"`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err = ScrubContext(ctx, users, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, got)
+
+	// Cancel the scrubbing once it has started: the values scrubbed so far
+	// must be restored.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	events := &Events{Events: []map[string]interface{}{
+		{"password": "hunter2"},
+		{"kind": "login", "password": "hunter3"},
+	}}
+
+	calls := 0
+	_, err = ScrubContext(ctx, events, map[string]FieldScrubOptioner{
+		"password": NewMask().Strategy(func(value string) (string, bool) {
+			if calls++; calls == 1 {
+				cancel()
+			}
+
+			return "********", true
+		}),
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "hunter2", events.Events[0]["password"])
+	assert.Equal(t, "hunter3", events.Events[1]["password"])
+}
+
+// TestScrubReport tests listing the paths of the values which would be masked.
+func TestScrubReport(t *testing.T) {
+	users := &Users{
+		Secret: "secret",
+		UserInfo: []User{
+			{Username: "John Doe", Password: "hunter2", DbSecrets: []string{"db1", ""}},
+			{Username: "Jane Doe", Password: ""},
+		},
+	}
+
+	paths, err := ScrubReport(users, map[string]FieldScrubOptioner{
+		"password": nil, "secret": nil, "dbsecrets": nil,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Secret", "UserInfo[0].DbSecrets[0]", "UserInfo[0].Password"}, paths)
+	assert.Equal(t, "hunter2", users.UserInfo[0].Password)
+
+	events := Events{Events: []map[string]interface{}{{"password": "hunter2", "kind": "login"}}}
+	paths, err = ScrubReport(events, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Events[0].password"}, paths)
+
+	_, err = ScrubReport(events, nil, WithMaxMapEntries(1), WithStrict(true))
+	assert.ErrorIs(t, err, ErrTooManyMapEntries)
+}
+
+// TestScrubE tests scrubbing with the errors returned.
+func TestScrubE(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	got, err := ScrubE(user, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Username":"John Doe","Password":"********","DbSecrets":null}`, got)
+
+	// Inputs legitimately marshalled to null.
+	for _, input := range []interface{}{nil, (*User)(nil)} {
+		got, err = ScrubE(input, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "null", got)
+	}
+
+	// Invalid input.
+	_, err = ScrubE(*user, nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// Marshal failure.
+	unsupported := &struct {
+		Password string
+		Done     chan bool
+	}{Password: "secret"}
+
+	var typeErr *json.UnsupportedTypeError
+	_, err = ScrubE(unsupported, nil)
+	assert.ErrorAs(t, err, &typeErr)
+	assert.Equal(t, "secret", unsupported.Password)
+}
+
+// TestScrubValue tests scrubbing values which are not pointers.
+func TestScrubValue(t *testing.T) {
+	secrets := []string{"John's_db_secret_1"}
+	user := User{Username: "John Doe", Password: "John_Doe's_Password", DbSecrets: secrets}
+	userScrubbed := &User{Username: "John Doe", Password: "********", DbSecrets: []string{"********"}}
+
+	fields := map[string]FieldScrubOptioner{"password": nil, "dbsecrets": nil}
+	validateScrubbed(t, user, userScrubbed, func() string { return ScrubValue(user, fields) })
+	validateScrubFields(t, user, userScrubbed, fields)
+	validateScrub(t, user, userScrubbed, map[string]bool{"password": true, "dbsecrets": true})
+
+	assert.Equal(t, "null", ScrubValue(nil, nil))
+	assert.Equal(t, `"hunter2"`, ScrubValue("hunter2", nil))
+}
+
+// TestScrubStruct tests scrubbing a struct in place.
+func TestScrubStruct(t *testing.T) {
+	john := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	directory := &Directory{Users: map[string]*User{"john": john}}
+
+	err := ScrubStruct(directory, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "********", john.Password)
+	assert.Equal(t, "John Doe", john.Username)
+
+	// Nothing is scrubbed if the scrubbing is stopped in strict mode.
+	events := &Events{Events: []map[string]interface{}{{"password": "a", "token": "b"}}}
+	err = ScrubStruct(events, map[string]FieldScrubOptioner{"password": nil, "token": nil},
+		WithStrict(true), WithMaxMapEntries(1))
+	assert.ErrorIs(t, err, ErrTooManyMapEntries)
+	assert.Equal(t, map[string]interface{}{"password": "a", "token": "b"}, events.Events[0])
+
+	// Invalid inputs.
+	for _, target := range []interface{}{*john, (*User)(nil), nil} {
+		assert.ErrorIs(t, ScrubStruct(target, nil), ErrInvalidInput)
+	}
+}
+
+// TestScrubBoth tests getting both a scrubbed value and its formatted string.
+func TestScrubBoth(t *testing.T) {
+	user := &User{Username: "John Doe", Password: "hunter2"}
+
+	scrubbed, got, err := ScrubBoth(user, nil)
+	assert.NoError(t, err)
+	assert.Same(t, user, scrubbed)
+	assert.Equal(t, "********", user.Password)
+	assert.Equal(t, `{"Username":"John Doe","Password":"********","DbSecrets":null}`, got)
+
+	_, got, err = ScrubBoth(&User{Password: "hunter2"}, nil, WithDataType(YAMLScrub))
+	assert.NoError(t, err)
+	assert.Equal(t, "username: \"\"\npassword: '********'\ndbsecrets: []\n", got)
+
+	_, _, err = ScrubBoth(*user, nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, _, err = ScrubBoth(&Events{Events: []map[string]interface{}{{"c": make(chan int)}}}, nil)
+	assert.Error(t, err)
+}
+
+// TestScrubPublicTypes tests that values of public types are never scrubbed.
+func TestScrubPublicTypes(t *testing.T) {
+	PublicTypes[reflect.TypeOf(PublicKey{})] = true
+	defer delete(PublicTypes, reflect.TypeOf(PublicKey{}))
+
+	pair := &KeyPair{
+		Secret: "private_key",
+		Public: PublicKey{Secret: "public_key"},
+		Peers:  []*PublicKey{{Secret: "peer_key"}},
+	}
+
+	pairScrubbed := &KeyPair{
+		Secret: "********",
+		Public: PublicKey{Secret: "public_key"},
+		Peers:  []*PublicKey{{Secret: "peer_key"}},
+	}
+
+	validateScrub(t, pair, pairScrubbed, map[string]bool{"secret": true})
+}
+
+// TestScrubHeaders tests scrubbing header maps with canonicalized keys.
+func TestScrubHeaders(t *testing.T) {
+	httpHeader := http.Header{}
+	httpHeader.Set("authorization", "Bearer abc.def.ghi")
+	httpHeader.Add("set-cookie", "session=1")
+	httpHeader.Add("set-cookie", "theme=dark")
+	httpHeader.Set("content-type", "application/json")
+
+	mimeHeader := textproto.MIMEHeader{}
+	mimeHeader.Set("mime-header", "secret_part")
+	mimeHeader.Set("content-disposition", "attachment")
+
+	msg := &Message{HTTP: httpHeader, MIME: mimeHeader}
+
+	msgScrubbed := &Message{
+		HTTP: http.Header{
+			"Authorization": {"********"},
+			"Set-Cookie":    {"********", "********"},
+			"Content-Type":  {"application/json"},
+		},
+		MIME: textproto.MIMEHeader{
+			"Mime-Header":         {"********"},
+			"Content-Disposition": {"attachment"},
+		},
+	}
+
+	secretFields := map[string]bool{
+		"authorization": true, "set-cookie": true, "mime-header": true}
+	validateScrub(t, msg, msgScrubbed, secretFields)
+
+	// The original headers must be restored after scrubbing.
+	assert.Equal(t, []string{"session=1", "theme=dark"}, httpHeader.Values("Set-Cookie"))
+	assert.Equal(t, "secret_part", mimeHeader.Get("Mime-Header"))
+
+	// A header map can be scrubbed directly as well.
+	want, _ := json.Marshal(msgScrubbed.HTTP)
+	assert.Equal(t, string(want), Scrub(&httpHeader, secretFields))
+}
+
+// TestScrubMaxMapEntries tests limiting the number of map entries to scrub.
+func TestScrubMaxMapEntries(t *testing.T) {
+	header := http.Header{}
+	for i := 0; i < 1000; i++ {
+		header.Set(fmt.Sprintf("X-Key-%d", i), "value")
+	}
+	header.Set("Authorization", "Bearer abc")
+	secretFields := map[string]bool{"authorization": true}
+
+	// Up to the limit, entries are scrubbed.
+	got := Scrub(&header, secretFields, WithMaxMapEntries(len(header)))
+	assert.Contains(t, got, `"Authorization":["********"]`)
+
+	// Beyond the limit, entries are left as is.
+	tokens := http.Header{"Authorization": {"Bearer abc"}, "Set-Cookie": {"session=1"}}
+	got = Scrub(&tokens, map[string]bool{"authorization": true, "set-cookie": true},
+		WithMaxMapEntries(1))
+	assert.Equal(t, 1, strings.Count(got, "********"))
+
+	// Beyond the limit, strict mode fails.
+	got, err := NewScrubber(nil, WithMaxMapEntries(10), WithStrict(true)).Scrub(&header)
+	assert.ErrorIs(t, err, ErrTooManyMapEntries)
+	assert.Equal(t, "", got)
+	assert.Equal(t, "", Scrub(&header, secretFields, WithMaxMapEntries(10), WithStrict(true)))
+
+	// The limit counts the entries of all maps, including raw JSON objects.
+	batch := &Batch{
+		Records: []json.RawMessage{
+			json.RawMessage(`{"a":"1","b":"2"}`),
+			json.RawMessage(`{"c":"3","d":"4"}`),
+		},
+	}
+	_, err = NewScrubber(nil, WithMaxMapEntries(3), WithStrict(true)).Scrub(batch)
+	assert.ErrorIs(t, err, ErrTooManyMapEntries)
+
+	_, err = NewScrubber(nil, WithMaxMapEntries(4), WithStrict(true)).Scrub(batch)
+	assert.NoError(t, err)
+
+	// The original values must be restored even if scrubbing fails.
+	assert.Equal(t, "Bearer abc", header.Get("Authorization"))
+}
+
+// TestScrubInterfaceSlice tests scrubbing maps and structs held by interfaces.
+func TestScrubInterfaceSlice(t *testing.T) {
+	records := &Records{
+		Records: []interface{}{
+			map[string]interface{}{"username": "John Doe", "password": "John_Doe's_Password"},
+			map[string]interface{}{"username": "Jane Doe", "Password": "Jane_Doe's_Password", "age": 42},
+			&User{Username: "Jim Doe", Password: "Jim_Doe's_Password"},
+			User{Username: "Joe Doe", Password: "Joe_Doe's_Password"},
+			"plain_string",
+			nil,
+		},
+	}
+
+	recordsScrubbed := &Records{
+		Records: []interface{}{
+			map[string]interface{}{"username": "John Doe", "password": "********"},
+			map[string]interface{}{"username": "Jane Doe", "Password": "********", "age": 42},
+			&User{Username: "Jim Doe", Password: "********"},
+			User{Username: "Joe Doe", Password: "********"},
+			"plain_string",
+			nil,
+		},
+	}
+
+	validateScrub(t, records, recordsScrubbed, nil)
+
+	// The original records must be restored after scrubbing.
+	assert.Equal(t, "John_Doe's_Password",
+		records.Records[0].(map[string]interface{})["password"])
+	assert.Equal(t, "Jim_Doe's_Password", records.Records[2].(*User).Password)
+	assert.Equal(t, "Joe_Doe's_Password", records.Records[3].(User).Password)
+}
+
+// TestScrubMapOfStructPointers tests scrubbing structs pointed to by map values.
+func TestScrubMapOfStructPointers(t *testing.T) {
+	john := &User{Username: "John Doe", Password: "John_Doe's_Password",
+		DbSecrets: []string{"John's_db_secret_1"}}
+	dir := &Directory{
+		Users: map[string]*User{
+			"john": john,
+			"jane": {Username: "Jane Doe", Password: "Jane_Doe's_Password"},
+			"none": nil,
+		},
+	}
+
+	dirScrubbed := &Directory{
+		Users: map[string]*User{
+			"john": {Username: "John Doe", Password: "********",
+				DbSecrets: []string{"********"}},
+			"jane": {Username: "Jane Doe", Password: "********"},
+			"none": nil,
+		},
+	}
+
+	validateScrub(t, dir, dirScrubbed, map[string]bool{"password": true, "dbsecrets": true})
+
+	// The pointed-to structs must be restored in place after scrubbing.
+	assert.Same(t, john, dir.Users["john"])
+	assert.Equal(t, "John_Doe's_Password", john.Password)
+	assert.Equal(t, []string{"John's_db_secret_1"}, john.DbSecrets)
+}
+
+// TestScrubMapsOfTypedValues tests scrubbing typed structs held by generic maps.
+func TestScrubMapsOfTypedValues(t *testing.T) {
+	john := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	events := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "login", "actor": john, "password": "typed_in"},
+			{"kind": "audit", "subject": User{Username: "Jane Doe", Password: "Jane_Doe's_Password"}},
+			{"kind": "noop", "actor": (*User)(nil)},
+		},
+	}
+
+	eventsScrubbed := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "login", "actor": &User{Username: "John Doe", Password: "********"},
+				"password": "********"},
+			{"kind": "audit", "subject": User{Username: "Jane Doe", Password: "********"}},
+			{"kind": "noop", "actor": (*User)(nil)},
+		},
+	}
+
+	validateScrub(t, events, eventsScrubbed, nil)
+}
+
+// TestScrubMapOfStringSlices tests scrubbing slices of strings held by generic maps.
+func TestScrubMapOfStringSlices(t *testing.T) {
+	keys := []string{"a", "b"}
+	events := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "rotate", "keys": keys, "tags": []string{"c"}},
+		},
+	}
+
+	eventsScrubbed := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "rotate", "keys": []string{"********", "********"}, "tags": []string{"c"}},
+		},
+	}
+
+	validateScrub(t, events, eventsScrubbed, map[string]bool{"keys": true})
+}
+
+// TestScrubMapOfStrings tests scrubbing the string values of typed maps.
+func TestScrubMapOfStrings(t *testing.T) {
+	fields := map[string]string{"username": "jdoe", "password": "hunter2"}
+	part := map[string]string{"password": "hunter3", "note": ""}
+	form := &Form{
+		Fields: fields,
+		Parts:  []interface{}{part, map[string]string{"password": ""}},
+	}
+
+	formScrubbed := &Form{
+		Fields: map[string]string{"username": "jdoe", "password": "********"},
+		Parts: []interface{}{
+			map[string]string{"password": "********", "note": ""},
+			map[string]string{"password": ""},
+		},
+	}
+
+	validateScrub(t, form, formScrubbed, nil)
+}
+
+// TestScrubMapOfStringPointers tests scrubbing pointers to strings held by generic maps.
+func TestScrubMapOfStringPointers(t *testing.T) {
+	password := "hunter2"
+	events := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "login", "password": &password},
+			{"kind": "logout", "password": (*string)(nil)},
+		},
+	}
+
+	masked := "********"
+	eventsScrubbed := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "login", "password": &masked},
+			{"kind": "logout", "password": (*string)(nil)},
+		},
+	}
+
+	validateScrub(t, events, eventsScrubbed, nil)
+}
+
+// TestScrubAnonymousStructSlice tests scrubbing slices of anonymous structs.
+func TestScrubAnonymousStructSlice(t *testing.T) {
+	type tokens struct {
+		Owner  string
+		Tokens []struct{ Value string }
+	}
+
+	msg := &tokens{Owner: "John Doe", Tokens: []struct{ Value string }{{"tok_1"}, {"tok_2"}}}
+	msgScrubbed := &tokens{Owner: "John Doe", Tokens: []struct{ Value string }{{"********"}, {"********"}}}
+
+	validateScrub(t, msg, msgScrubbed, map[string]bool{"value": true})
+	validateScrub(t, *msg, msgScrubbed, map[string]bool{"value": true})
+}
+
+// TestScrubNonString tests scrubbing numbers and booleans on request.
+func TestScrubNonString(t *testing.T) {
+	account := &BankAccount{
+		Holder:        "John Doe",
+		SSN:           123456789,
+		AccountNumber: 9876543210,
+		Balance:       -42.5,
+		Overdrawn:     true,
+		Limits:        []int32{100, 200},
+	}
+
+	nonString := NewMask().ScrubNonString(true)
+	accountScrubbed := &BankAccount{Holder: "John Doe", Limits: []int32{0, 0}}
+	validateScrubFields(t, account, accountScrubbed, map[string]FieldScrubOptioner{
+		"ssn":           nonString,
+		"accountnumber": nonString,
+		"balance":       nonString,
+		"overdrawn":     nonString,
+		"limits":        nonString,
+	})
+
+	// Numbers and booleans are left as is by default.
+	validateScrubFields(t, account, account, map[string]FieldScrubOptioner{
+		"ssn": nil, "balance": NewMask(), "overdrawn": nil,
+	})
+}
+
+// Struct with fields of unusual kinds
+type Handle struct {
+	Password string
+	Phase    complex128
+	Addr     uintptr
+	Raw      unsafe.Pointer
+	Done     chan struct{}
+	Callback func() string
+	Next     **string
+}
+
+// TestScrubUnusualKinds tests that fields of unusual kinds are scrubbed
+// gracefully.
+func TestScrubUnusualKinds(t *testing.T) {
+	secret := "hunter2"
+	secretPtr := &secret
+	done := make(chan struct{})
+	handle := &Handle{
+		Password: "hunter2",
+		Phase:    complex(1, 2),
+		Addr:     42,
+		Raw:      unsafe.Pointer(&secret),
+		Done:     done,
+		Callback: func() string { return "hunter2" },
+		Next:     &secretPtr,
+	}
+
+	nonString := NewMask().ScrubNonString(true)
+	err := ScrubStruct(handle, map[string]FieldScrubOptioner{
+		"password": nil, "phase": nonString, "addr": nonString, "raw": nonString,
+		"done": nonString, "callback": nonString, "next": nonString,
+	}, WithStrict(true))
+	assert.NoError(t, err)
+
+	// Numbers are zeroed, while the values of the other kinds are left as is.
+	assert.Equal(t, "********", handle.Password)
+	assert.Equal(t, complex128(0), handle.Phase)
+	assert.Equal(t, uintptr(0), handle.Addr)
+	assert.Equal(t, unsafe.Pointer(&secret), handle.Raw)
+	assert.Equal(t, done, handle.Done)
+	assert.Equal(t, "hunter2", handle.Callback())
+	assert.Equal(t, "hunter2", **handle.Next)
+}
+
+// TestScrubMapOfInterfaceSlices tests scrubbing slices of strings held as
+// []interface{} by generic maps.
+func TestScrubMapOfInterfaceSlices(t *testing.T) {
+	keys := []interface{}{"key_1", "key_2_abcdef", 42, nil}
+	events := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "rotate", "keys": keys, "tags": []interface{}{"c"}},
+		},
+	}
+
+	eventsScrubbed := &Events{
+		Events: []map[string]interface{}{
+			{"kind": "rotate", "keys": []interface{}{"********", "key********", 42, nil},
+				"tags": []interface{}{"c"}},
+		},
+	}
+
+	validateScrub(t, events, eventsScrubbed, map[string]bool{"keys": true}, WithAlwaysShowFirst(3))
+}
+
+// TestScrubDecodedJSONArrays tests scrubbing arrays of strings under
+// sensitive keys of JSON decoded into generic values.
+func TestScrubDecodedJSONArrays(t *testing.T) {
+	var record interface{}
+	err := json.Unmarshal([]byte(
+		`{"user":"john","password":["secret1","secret2"],"nested":{"password":["secret3",7]}}`), &record)
+	assert.NoError(t, err)
+
+	validateScrub(t, &record, json.RawMessage(
+		`{"nested":{"password":["********",7]},"password":["********","********"],"user":"john"}`), nil)
+}
+
+// TestScrubNameAffixes tests scrubbing fields by the prefixes and suffixes
+// of their names.
+func TestScrubNameAffixes(t *testing.T) {
+	record := map[string]interface{}{
+		"apiToken":   "tok_1",
+		"userToken":  "tok_2",
+		"token":      "tok_3",
+		"user_token": "tok_4",
+		"tokenType":  "bearer",
+		"secretKey":  "key_1",
+		"refToken":   "tok_5",
+		"username":   "john",
+	}
+
+	got := Scrub(&record, map[string]bool{"reftoken": true},
+		WithSuffixMatch("TOKEN", NewMask().Token("[token]")),
+		WithPrefixMatch("secret", nil),
+		WithPrefixMatch("user", NewMask().Token("[user]")))
+	assert.Equal(t, `{"apiToken":"[token]","refToken":"********","secretKey":"********",`+
+		`"token":"[token]","tokenType":"bearer","userToken":"[token]",`+
+		`"user_token":"[token]","username":"[user]"}`, got)
+
+	// Excluded fields are never scrubbed.
+	got = Scrub(&record, map[string]bool{}, WithSuffixMatch("token", nil),
+		WithExcludedFields("apiToken"))
+	assert.Contains(t, got, `"apiToken":"tok_1"`)
+	assert.Contains(t, got, `"token":"********"`)
+
+	// Struct fields are matched too.
+	user := &User{Username: "john", Password: "hunter2"}
+	got = Scrub(user, map[string]bool{}, WithSuffixMatch("word", nil))
+	assert.Equal(t, `{"Username":"john","Password":"********","DbSecrets":null}`, got)
+}
+
+// TestScrubInterfaceFieldMaps tests scrubbing maps held by interface{}
+// fields of structs, at any nesting level.
+func TestScrubInterfaceFieldMaps(t *testing.T) {
+	type envelope struct {
+		Kind    string
+		Payload interface{}
+	}
+
+	payload := map[string]interface{}{
+		"password": "hunter2",
+		"nested":   map[string]interface{}{"password": "hunter3"},
+		"items":    []interface{}{map[string]interface{}{"password": "hunter4"}},
+	}
+	msg := &envelope{Kind: "login", Payload: payload}
+
+	validateScrub(t, msg, json.RawMessage(`{"Kind":"login","Payload":{"items":[{"password":"********"}],`+
+		`"nested":{"password":"********"},"password":"********"}}`), nil)
+}
+
+// Struct referring to itself
+type Node struct {
+	Password string
+	Next     *Node
+	Children []interface{}
+}
+
+// TestScrubCyclic tests scrubbing values referring to themselves.
+func TestScrubCyclic(t *testing.T) {
+	node := &Node{Password: "hunter2"}
+	node.Next = &Node{Password: "hunter3", Next: node}
+	node.Children = []interface{}{node, node.Next}
+
+	err := ScrubStruct(node, nil, WithStrict(true))
+	assert.NoError(t, err)
+	assert.Equal(t, "********", node.Password)
+	assert.Equal(t, "********", node.Next.Password)
+
+	record := map[string]interface{}{"password": "hunter2"}
+	record["self"] = record
+	paths, err := ScrubReport(record, nil, WithStrict(true))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"password"}, paths)
+	assert.Equal(t, "hunter2", record["password"])
+}
+
+// TestScrubCyclicSlice tests scrubbing slices holding themselves.
+func TestScrubCyclicSlice(t *testing.T) {
+	items := []interface{}{nil, nil, nil, map[string]interface{}{"password": "hunter2"}}
+	items[0], items[1], items[2] = items, items, items
+
+	paths, err := ScrubReport(&items, nil, WithStrict(true))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"[3].password"}, paths)
+
+	paths, err = ScrubReport(&items, nil, WithMaxNesting(30))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"[3].password"}, paths)
+}
+
+// TestScrubMaxNesting tests scrubbing values nested deeper than allowed.
+func TestScrubMaxNesting(t *testing.T) {
+	newList := func() *Node {
+		list := &Node{Password: "hunter2"}
+		for i := 0; i < 50; i++ {
+			list = &Node{Next: list}
+		}
+		return list
+	}
+	last := func(list *Node) *Node {
+		for list.Next != nil {
+			list = list.Next
+		}
+		return list
+	}
+
+	list := newList()
+	assert.NoError(t, ScrubStruct(list, nil, WithStrict(true)))
+	assert.Equal(t, "********", last(list).Password)
+
+	// Deeper values are left as is, unless in strict mode.
+	list = newList()
+	assert.NoError(t, ScrubStruct(list, nil, WithMaxNesting(20)))
+	assert.Equal(t, "hunter2", last(list).Password)
+
+	err := ScrubStruct(list, nil, WithMaxNesting(20), WithStrict(true))
+	assert.ErrorIs(t, err, ErrTooDeep)
+}
+
+// TestScrubDepth tests scrubbing fields only at a given depth.
+func TestScrubDepth(t *testing.T) {
+	type login struct {
+		Password string
+		User     User
+		Users    []User
+		Extra    map[string]interface{}
+	}
+
+	msg := &login{
+		Password: "top_secret",
+		User:     User{Username: "John Doe", Password: "John_Doe's_Password"},
+		Users:    []User{{Username: "Jane Doe", Password: "Jane_Doe's_Password"}},
+		Extra:    map[string]interface{}{"password": "map_secret"},
+	}
+
+	got := Scrub(msg, nil, WithDepth(0))
+	want, _ := json.Marshal(&login{
+		Password: "********",
+		User:     User{Username: "John Doe", Password: "John_Doe's_Password"},
+		Users:    []User{{Username: "Jane Doe", Password: "Jane_Doe's_Password"}},
+		Extra:    map[string]interface{}{"password": "map_secret"},
+	})
+	assert.Equal(t, string(want), got)
+
+	got = Scrub(msg, nil, WithDepth(1))
+	want, _ = json.Marshal(&login{
+		Password: "top_secret",
+		User:     User{Username: "John Doe", Password: "********"},
+		Users:    []User{{Username: "Jane Doe", Password: "********"}},
+		Extra:    map[string]interface{}{"password": "********"},
+	})
+	assert.Equal(t, string(want), got)
+
+	// Fields are scrubbed at any depth by default.
+	assert.Equal(t, Scrub(msg, nil), Scrub(msg, nil, WithDepth(-1)))
+	assert.Equal(t, "top_secret", msg.Password)
+}
+
+// TestScrubNestedMaps tests scrubbing maps held directly by other maps.
+func TestScrubNestedMaps(t *testing.T) {
+	inner := map[string]interface{}{"password": "x", "name": "inner"}
+	events := &Events{
+		Events: []map[string]interface{}{
+			{
+				"outer": inner,
+				"deep": map[string]interface{}{
+					"deeper": map[string]string{"password": "y", "name": "deeper"},
+				},
+			},
+		},
+	}
+
+	eventsScrubbed := &Events{
+		Events: []map[string]interface{}{
+			{
+				"outer": map[string]interface{}{"password": "********", "name": "inner"},
+				"deep": map[string]interface{}{
+					"deeper": map[string]string{"password": "********", "name": "deeper"},
+				},
+			},
+		},
+	}
+
+	validateScrub(t, events, eventsScrubbed, nil)
+}
+
+// Struct with optional fields
+type Signup struct {
+	Email    *string
+	Password *string
+	Confirm  *string
+}
+
+// TestScrubStringPointers tests scrubbing pointer-to-string fields.
+func TestScrubStringPointers(t *testing.T) {
+	email, password := "john@example.com", "hunter2"
+	signup := &Signup{Email: &email, Password: &password}
+
+	masked := "********"
+	signupScrubbed := &Signup{Email: &email, Password: &masked}
+	validateScrubFields(t, signup, signupScrubbed, map[string]FieldScrubOptioner{
+		"password": nil, "confirm": nil,
+	})
+
+	// The original value must be restored after scrubbing.
+	assert.Equal(t, "hunter2", password)
+	assert.Same(t, &password, signup.Password)
+}
+
+// Structs embedding others with fields of the same names
+type OAuth struct {
+	Token string
+}
+
+type Basic struct {
+	Token string
+}
+
+type Connection struct {
+	OAuth
+	*Basic
+	Proxy  Basic
+	Tokens map[string]Basic
+}
+
+// TestScrubQualifiedFields tests scrubbing fields qualified by the names of
+// their parents.
+func TestScrubQualifiedFields(t *testing.T) {
+	conn := &Connection{
+		OAuth:  OAuth{Token: "oauth_token"},
+		Basic:  &Basic{Token: "basic_token"},
+		Proxy:  Basic{Token: "proxy_token"},
+		Tokens: map[string]Basic{"backup": {Token: "backup_token"}},
+	}
+
+	connScrubbed := &Connection{
+		OAuth:  OAuth{Token: "oauth_token"},
+		Basic:  &Basic{Token: "<basic>"},
+		Proxy:  Basic{Token: "proxy_token"},
+		Tokens: map[string]Basic{"backup": {Token: "********"}},
+	}
+
+	validateScrubFields(t, conn, connScrubbed, map[string]FieldScrubOptioner{
+		"basic.token":         NewMask().Token("<basic>"),
+		"tokens.backup.token": nil,
+	})
+
+	// Qualified names take precedence over shorter ones.
+	connScrubbed = &Connection{
+		OAuth:  OAuth{Token: "********"},
+		Basic:  &Basic{Token: "<basic>"},
+		Proxy:  Basic{Token: "********"},
+		Tokens: map[string]Basic{"backup": {Token: "********"}},
+	}
+
+	validateScrubFields(t, conn, connScrubbed, map[string]FieldScrubOptioner{
+		"token":       nil,
+		"Basic.Token": NewMask().Token("<basic>"),
+	})
+
+	// In raw JSON too.
+	got, err := ScrubJSON([]byte(`{"a":{"token":"t1"},"b":[{"token":"t2"}]}`),
+		map[string]FieldScrubOptioner{"b.token": nil})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":{"token":"t1"},"b":[{"token":"********"}]}`, string(got))
+}
+
+// Struct with a value whose sensitivity depends on its type
+type Identifier struct {
+	Type  string
+	Value string
+}
+
+// TestScrubWhen tests scrubbing fields depending on their siblings.
+func TestScrubWhen(t *testing.T) {
+	sensitive := func(siblings map[string]string) bool {
+		return siblings["type"] == "ssn" || siblings["type"] == "passport"
+	}
+
+	fields := map[string]FieldScrubOptioner{
+		"value": NewMask().When(sensitive),
+		// Scrubbing a sibling doesn't affect the others.
+		"type": NewMask().Token("<type>").When(sensitive),
+	}
+
+	ids := []Identifier{{Type: "ssn", Value: "123-45-6789"}, {Type: "email", Value: "a@b.c"}}
+	idsScrubbed := []Identifier{{Type: "<type>", Value: "********"}, {Type: "email", Value: "a@b.c"}}
+	got, err := ScrubSlice(&ids, fields)
+	assert.NoError(t, err)
+	b, _ := json.Marshal(idsScrubbed)
+	assert.Equal(t, string(b), got)
+	assert.Equal(t, "123-45-6789", ids[0].Value)
+
+	events := &Events{Events: []map[string]interface{}{
+		{"type": "passport", "value": "X1234567", "nested": map[string]interface{}{"value": "v"}},
+		{"type": "phone", "value": "555-1234"},
+	}}
+
+	eventsScrubbed := &Events{Events: []map[string]interface{}{
+		{"type": "<type>", "value": "********", "nested": map[string]interface{}{"value": "v"}},
+		{"type": "phone", "value": "555-1234"},
+	}}
+
+	validateScrubFields(t, events, eventsScrubbed, fields)
+}
+
+// TestScrubMaskSubtree tests masking every leaf beneath a sensitive field.
+func TestScrubMaskSubtree(t *testing.T) {
+	account := &Account{
+		Name: "billing",
+		Credentials: Credentials{
+			Login:  "admin",
+			Secret: "hunter2",
+			Hosts:  []string{"db1", "db2"},
+		},
+		Extra: map[string]interface{}{
+			"region": "us-east",
+			"credentials": map[string]interface{}{
+				"login": "root", "nested": []interface{}{"a", map[string]interface{}{"b": "c"}},
+			},
+		},
+		Raw: json.RawMessage(`{"credentials":{"login":"raw","port":5432},"region":"eu"}`),
+	}
+
+	accountScrubbed := &Account{
+		Name: "billing",
+		Credentials: Credentials{
+			Login:  "<c>",
+			Secret: "<c>",
+			Hosts:  []string{"<c>", "<c>"},
+		},
+		Extra: map[string]interface{}{
+			"region": "us-east",
+			"credentials": map[string]interface{}{
+				"login": "<c>", "nested": []interface{}{"<c>", map[string]interface{}{"b": "<c>"}},
+			},
+		},
+		Raw: json.RawMessage(`{"credentials":{"login":"<c>","port":5432},"region":"eu"}`),
+	}
+
+	validateScrubFields(t, account, accountScrubbed, map[string]FieldScrubOptioner{
+		"credentials": NewMask().Token("<c>").MaskSubtree(true),
+		"secret":      NewMask().Token("<s>"),
+	})
+
+	// Without MaskSubtree, only the leaves to be scrubbed themselves are.
+	accountScrubbed.Credentials = Credentials{
+		Login:  "admin",
+		Secret: "<s>",
+		Hosts:  []string{"db1", "db2"},
+	}
+	accountScrubbed.Extra["credentials"] = account.Extra["credentials"]
+	accountScrubbed.Raw = json.RawMessage(`{"credentials":{"login":"raw","port":5432},"region":"eu"}`)
+
+	validateScrubFields(t, account, accountScrubbed, map[string]FieldScrubOptioner{
+		"credentials": NewMask().Token("<c>"),
+		"secret":      NewMask().Token("<s>"),
+	})
+	assert.Equal(t, "hunter2", account.Credentials.Secret)
+}
+
+// TestScrubSentinelField tests fully redacting the records marked by a sentinel field.
+func TestScrubSentinelField(t *testing.T) {
+	records := []Record{
+		{ID: "1", Owner: "John Doe", Notes: []string{"public"}},
+		{ID: "2", Owner: "Jane Doe", Notes: []string{"secret"}, Confidential: true},
+	}
+
+	recordsScrubbed := []Record{
+		{ID: "1", Owner: "John Doe", Notes: []string{"public"}},
+		{ID: "********", Owner: "********", Notes: []string{"********"}, Confidential: true},
+	}
+
+	validateScrubFields(t, &records, recordsScrubbed, map[string]FieldScrubOptioner{},
+		WithSentinelField("confidential", true))
+
+	// A sentinel value of another type than the field never matches.
+	got, err := ScrubSlice(&records, map[string]FieldScrubOptioner{},
+		WithSentinelField("confidential", "true"))
+	assert.NoError(t, err)
+	assert.Contains(t, got, "Jane Doe")
+}
+
+// TestScrubCaseFolding tests matching field names with Unicode case folding.
+func TestScrubCaseFolding(t *testing.T) {
+	record := &Records{
+		Records: []interface{}{
+			map[string]interface{}{
+				"Straße":   "Hauptstraße 1",
+				"ŞİFRE":    "gizli",
+				"ΚΩΔΙΚΌΣ":  "μυστικό",
+				"KELVIN":   "273",
+				"username": "Jürgen",
+			},
+		},
+	}
+
+	recordScrubbed := &Records{
+		Records: []interface{}{
+			map[string]interface{}{
+				"Straße":   "********",
+				"ŞİFRE":    "********",
+				"ΚΩΔΙΚΌΣ":  "********",
+				"KELVIN":   "********",
+				"username": "Jürgen",
+			},
+		},
+	}
+
+	secretFields := map[string]bool{
+		"STRASSE":     true, // ß folds to ss
+		"şifre":       true, // İ lowercases to i
+		"κωδικός":     true, // final sigma folds to σ
+		"\u212aelvin": true, // Kelvin sign folds to k
+	}
+	validateScrub(t, record, recordScrubbed, secretFields)
+}
+
+// TestScrubDrop tests dropping fields instead of masking them.
+func TestScrubDrop(t *testing.T) {
+	fields := map[string]FieldScrubOptioner{"password": NewMask().Drop(true)}
+
+	// Map entries are removed, and restored after scrubbing.
+	record := map[string]interface{}{"username": "John Doe", "password": "hunter2"}
+	got := ScrubFields(&record, fields)
+	assert.Equal(t, `{"username":"John Doe"}`, got)
+	assert.Equal(t, "hunter2", record["password"])
+
+	// Struct fields cannot be removed, so strings are emptied.
+	user := &User{Username: "John Doe", Password: "hunter2"}
+	validateScrubFields(t, user, &User{Username: "John Doe"}, fields)
+	assert.Equal(t, "hunter2", user.Password)
+
+	// Raw JSON members are removed, keeping the order of the others.
+	raw, err := ScrubJSON([]byte(`{"z":1,"password":"hunter2","a":[{"password":"x"}]}`), fields)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"z":1,"a":[{}]}`, string(raw))
+}
+
+// TestScrubLocked tests scrubbing a struct shared with a goroutine modifying
+// it, its maps and its slices, which must pass with the race detector.
+func TestScrubLocked(t *testing.T) {
+	var mu sync.Mutex
+	form := &Form{
+		Fields: map[string]string{"username": "John Doe", "password": "hunter2"},
+		Parts:  []interface{}{map[string]string{"password": "hunter3"}},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mu.Lock()
+			form.Fields["username"] = fmt.Sprintf("user%d", i)
+			form.Parts[0] = map[string]string{"password": fmt.Sprintf("secret%d", i)}
+			mu.Unlock()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		got := ScrubLocked(&mu, *form, nil)
+		assert.Contains(t, got, `"Fields":{"password":"********"`)
+		assert.Contains(t, got, `"Parts":[{"password":"********"}]`)
+	}
+	<-done
+
+	assert.Equal(t, "hunter2", form.Fields["password"])
+}
+
+// validateScrub is a helper function to validate scrubbing functionality on a struct.
+func validateScrub(t *testing.T, msg, scrubbedMsg interface{}, secretFields map[string]bool,
+	opts ...Option) {
+	t.Helper()
+
+	validateScrubbed(t, msg, scrubbedMsg, func() string {
+		// Get the scrubbed string from util API.
+		return Scrub(msg, secretFields, opts...)
+	})
+}
+
+// validateScrubFields is a helper function to validate scrubbing functionality on a
+// struct with per-field scrubbing options.
+func validateScrubFields(t *testing.T, msg, scrubbedMsg interface{},
+	secretFields map[string]FieldScrubOptioner, opts ...Option) {
+	t.Helper()
+
+	validateScrubbed(t, msg, scrubbedMsg, func() string {
+		return ScrubFields(msg, secretFields, opts...)
+	})
+}
+
+// validateScrubbed validates that 'scrub' returns the JSON representation of
+// 'scrubbedMsg', which may be given as json.RawMessage, and that 'msg' is
+// left as it was.
+func validateScrubbed(t *testing.T, msg, scrubbedMsg interface{}, scrub func() string) {
+	t.Helper()
+
+	original, _ := json.Marshal(msg)
+	got := scrub()
+
+	// Compare it against the given scrubbed representaation.
+	var b []byte
+	b, _ = json.Marshal(scrubbedMsg)
+	want := string(b)
+
+	assert.Equal(t, want, got,
+		"JSON representation mismatch after scrubbing sensitive fields")
+
+	// The original values must be restored after scrubbing.
+	restored, _ := json.Marshal(msg)
+	assert.Equal(t, string(original), string(restored),
+		"original values not restored after scrubbing")
+}
+
+// BenchmarkScrub benchmarks scrubbing a struct to a string.
+func BenchmarkScrub(b *testing.B) {
+	user := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Scrub(user, nil)
+	}
+}
+
+// BenchmarkScrubAndWrite benchmarks scrubbing a struct to buffers reused
+// from a pool.
+func BenchmarkScrubAndWrite(b *testing.B) {
+	user := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	pool := sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := pool.Get().(*bytes.Buffer)
+		buf.Reset()
+		_ = ScrubAndWrite(buf, user, nil)
+		pool.Put(buf)
+	}
+}
+
+// BenchmarkScrubWideStruct benchmarks scrubbing a struct with many fields,
+// where looking up the field names dominates.
+func BenchmarkScrubWideStruct(b *testing.B) {
+	type account struct {
+		AccountID   string
+		DisplayName string
+		Email       string
+		Phone       string
+		Street      string
+		City        string
+		Country     string
+		Password    string
+		APIToken    string
+		CreatedAt   string
+		UpdatedAt   string
+		Status      string
+	}
+
+	accounts := make([]account, 10)
+	for i := range accounts {
+		accounts[i] = account{AccountID: "a1", Password: "hunter2", APIToken: "tok_1"}
+	}
+
+	fields := map[string]bool{"password": true, "apitoken": true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Scrub(&accounts, fields)
+	}
 }
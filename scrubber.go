@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidConfig is wrapped by the error returned by Scrubber.Validate.
+var ErrInvalidConfig = errors.New("scrub: invalid config")
+
+// Scrubber scrubs sensitive fields with a configuration given once, for
+// callers which scrub many values the same way. Its configuration is never
+// modified, so a Scrubber can be used concurrently, as long as the same
+// value is not scrubbed concurrently. Like ScrubValue, it scrubs a copy of
+// the inputs which are not pointers.
+type Scrubber struct {
+	fieldsToScrub map[string]FieldScrubOptioner
+	opts          []Option
+}
+
+// NewScrubber returns a Scrubber which scrubs 'fieldsToScrub' configured
+// with 'opts'. If 'fieldsToScrub' is nil, DefaultFields is used.
+func NewScrubber(fieldsToScrub map[string]FieldScrubOptioner, opts ...Option) *Scrubber {
+	return &Scrubber{
+		fieldsToScrub: fieldsToScrub,
+		opts:          opts,
+	}
+}
+
+// Scrub is like ScrubFields with the configuration of the Scrubber, but it
+// also returns the error, if any, of marshalling the scrubbed 'input'.
+func (s *Scrubber) Scrub(input interface{}) (string, error) {
+	return scrub(addressable(input), s.fieldsToScrub, s.opts)
+}
+
+// ScrubAs is like Scrub, but the scrubbed 'input' is formatted as 'dataType',
+// whatever the data type the Scrubber is configured with.
+func (s *Scrubber) ScrubAs(input interface{}, dataType DataType) (string, error) {
+	opts := append(s.opts[:len(s.opts):len(s.opts)], WithDataType(dataType))
+	return scrub(addressable(input), s.fieldsToScrub, opts)
+}
+
+// ScrubAndWrite is like Scrub, but it appends the scrubbed 'input' to 'buf'
+// instead of returning a string. See the package function ScrubAndWrite.
+func (s *Scrubber) ScrubAndWrite(buf *bytes.Buffer, input interface{}) error {
+	return newScrubState(s.fieldsToScrub, s.opts).scrubTo(buf, addressable(input))
+}
+
+// ScrubLengths is like Scrub, but it also returns the original length, in
+// characters, of every masked value by its path, such as
+// "UserInfo[0].Password". It lets the lengths of secrets be monitored without
+// their values. The lengths are nil if the scrubbing fails in strict mode.
+func (s *Scrubber) ScrubLengths(input interface{}) (string, map[string]int, error) {
+	state := newScrubState(s.fieldsToScrub, s.opts)
+	state.lengths = make(map[string]int)
+
+	out, err := state.scrub(addressable(input))
+	if state.err != nil {
+		return out, nil, err
+	}
+
+	return out, state.lengths, err
+}
+
+// Validate checks the configuration of the Scrubber, including the
+// FieldGroups it uses, so that a misconfiguration can fail fast at startup
+// rather than be found on the first scrubbed value. The "scrub" struct tags
+// of the types of 'samples', such as (*User)(nil), and of the types they
+// refer to are checked as well. It returns an error wrapping
+// ErrInvalidConfig which describes all the problems found, or nil.
+func (s *Scrubber) Validate(samples ...interface{}) error {
+	var problems []string
+
+	names := make([]string, 0, len(s.fieldsToScrub))
+	for name := range s.fieldsToScrub {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" {
+			problems = append(problems, "empty field name")
+			continue
+		}
+
+		o := fieldOptions(s.fieldsToScrub[name])
+		if o.Token != "" && o.Strategy != nil {
+			problems = append(problems,
+				fmt.Sprintf("field %q: strategy is ignored as a token is set", name))
+		}
+
+		if o.KeyByPath && (o.Strategy == nil || o.keyedStrategy == nil) {
+			problems = append(problems,
+				fmt.Sprintf("field %q: KeyByPath is ignored without Mask.Hash", name))
+		}
+
+		if o.ShowFirst < 0 || o.ShowLast < 0 {
+			problems = append(problems,
+				fmt.Sprintf("field %q: negative number of visible characters", name))
+		}
+	}
+
+	groups := make([]string, 0, len(FieldGroups))
+	for group := range FieldGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for _, group := range groups {
+		if len(FieldGroups[group]) == 0 {
+			problems = append(problems, fmt.Sprintf("group %q: no members", group))
+		}
+
+		for _, member := range FieldGroups[group] {
+			if member == "" {
+				problems = append(problems, fmt.Sprintf("group %q: empty member name", group))
+			}
+		}
+	}
+
+	opts := newOptions(s.opts)
+	if opts.excludedFields[""] {
+		problems = append(problems, "empty excluded field name")
+	}
+
+	if opts.alwaysShowFirst < 0 {
+		problems = append(problems,
+			fmt.Sprintf("negative number of visible characters: %d", opts.alwaysShowFirst))
+	}
+
+	if opts.alwaysShowLast < 0 {
+		problems = append(problems,
+			fmt.Sprintf("negative number of visible last characters: %d", opts.alwaysShowLast))
+	}
+
+	if opts.maskLen <= 0 {
+		problems = append(problems, fmt.Sprintf("non-positive mask length: %d", opts.maskLen))
+	}
+
+	if opts.maxMapEntries < 0 {
+		problems = append(problems,
+			fmt.Sprintf("negative number of map entries: %d", opts.maxMapEntries))
+	}
+
+	if opts.maxNesting <= 0 {
+		problems = append(problems,
+			fmt.Sprintf("non-positive maximum nesting: %d", opts.maxNesting))
+	}
+
+	for _, matcher := range opts.nameMatchers {
+		if matcher.affix == "" {
+			problems = append(problems, "empty field name prefix or suffix")
+		}
+	}
+
+	for _, pattern := range opts.valueMatchers {
+		if pattern == nil {
+			problems = append(problems, "nil value pattern")
+		}
+	}
+
+	for _, pattern := range opts.keyMatchers {
+		if pattern == nil {
+			problems = append(problems, "nil key pattern")
+		}
+	}
+
+	for _, iface := range opts.secretInterfaces {
+		if iface == nil || iface.Kind() != reflect.Interface {
+			problems = append(problems, fmt.Sprintf("secret type %v is not an interface", iface))
+		}
+	}
+
+	seen := make(map[reflect.Type]bool)
+	for _, sample := range samples {
+		problems = tagProblems(reflect.TypeOf(sample), seen, problems)
+	}
+
+	switch opts.dataType {
+	case "", JSONScrub, YAMLScrub:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown data type %q", opts.dataType))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+}
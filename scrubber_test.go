@@ -0,0 +1,117 @@
+package scrub
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScrubberValidate tests validating the configuration of a Scrubber.
+func TestScrubberValidate(t *testing.T) {
+	s := NewScrubber(map[string]FieldScrubOptioner{
+		"password": nil,
+		"token":    NewMask().Strategy(JWTSignatureMask),
+	}, WithAlwaysShowFirst(2), WithMaxMapEntries(100))
+	assert.NoError(t, s.Validate())
+	assert.NoError(t, NewScrubber(nil).Validate())
+
+	FieldGroups["apikey"] = []string{"keypart1", ""}
+	FieldGroups["empty"] = nil
+	defer delete(FieldGroups, "apikey")
+	defer delete(FieldGroups, "empty")
+
+	s = NewScrubber(map[string]FieldScrubOptioner{
+		"":         nil,
+		"password": nil,
+		"token":    NewMask().Strategy(JWTSignatureMask).Token("<jwt>"),
+		"pin":      NewMask().Partial(-1, 0),
+	}, WithAlwaysShowFirst(-1), WithAlwaysShowLast(-2), WithMaskLen(0),
+		WithMaxMapEntries(-5), WithExcludedFields(""), WithSuffixMatch("", nil),
+		WithMaxNesting(0), WithDataType("xml"))
+
+	err := s.Validate()
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.EqualError(t, err, "scrub: invalid config: "+
+		"empty field name; "+
+		`field "pin": negative number of visible characters; `+
+		`field "token": strategy is ignored as a token is set; `+
+		`group "apikey": empty member name; `+
+		`group "empty": no members; `+
+		"empty excluded field name; "+
+		"negative number of visible characters: -1; "+
+		"negative number of visible last characters: -2; "+
+		"non-positive mask length: 0; "+
+		"negative number of map entries: -5; "+
+		"non-positive maximum nesting: 0; "+
+		"empty field name prefix or suffix; "+
+		`unknown data type "xml"`)
+}
+
+// TestScrubberScrubLengths tests getting the original lengths of the masked values.
+func TestScrubberScrubLengths(t *testing.T) {
+	users := &Users{
+		UserInfo: []User{
+			{Username: "jdoe", Password: "short"},
+			{Username: "jroe", Password: "anomalously_long_pässword"},
+		},
+	}
+
+	s := NewScrubber(map[string]FieldScrubOptioner{"password": nil})
+	out, lengths, err := s.ScrubLengths(users)
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "short")
+	assert.Equal(t, map[string]int{
+		"UserInfo[0].Password": len([]rune(users.UserInfo[0].Password)),
+		"UserInfo[1].Password": len([]rune(users.UserInfo[1].Password)),
+	}, lengths)
+
+	_, lengths, err = NewScrubber(nil).ScrubLengths(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, lengths)
+}
+
+// TestScrubberScrubAs tests scrubbing values in a given data type, concurrently.
+func TestScrubberScrubAs(t *testing.T) {
+	s := NewScrubber(map[string]FieldScrubOptioner{"password": nil}, WithDataType(YAMLScrub))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			user := User{Username: fmt.Sprintf("user%d", i), Password: "hunter2"}
+			out, err := s.ScrubAs(user, JSONScrub)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf(
+				`{"Username":"user%d","Password":"********","DbSecrets":null}`, i), out)
+
+			out, err = s.Scrub(&user)
+			assert.NoError(t, err)
+			assert.Contains(t, out, "password: '********'")
+			assert.Equal(t, "hunter2", user.Password)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// TestScrubberScrubAndWrite tests appending values scrubbed by a Scrubber to
+// a buffer.
+func TestScrubberScrubAndWrite(t *testing.T) {
+	s := NewScrubber(map[string]FieldScrubOptioner{"password": nil})
+
+	users := []User{{Username: "John", Password: "p1"}, {Username: "Jane", Password: "p2"}}
+
+	var buf bytes.Buffer
+	for _, user := range users {
+		assert.NoError(t, s.ScrubAndWrite(&buf, user))
+		buf.WriteByte('\n')
+	}
+
+	assert.Equal(t, `{"Username":"John","Password":"********","DbSecrets":null}`+"\n"+
+		`{"Username":"Jane","Password":"********","DbSecrets":null}`+"\n", buf.String())
+}
@@ -0,0 +1,26 @@
+//go:build scrubdebug
+
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+// OnOriginal, if set, is called with the path (e.g. "UserInfo[0].Password")
+// and the original value of every field being scrubbed, so that developers
+// can see the original values next to the scrubbed output while debugging.
+//
+// It only exists when built with the "scrubdebug" build tag. Production builds
+// must not use this tag, so that they can never leak the original values.
+var OnOriginal func(path, value string)
+
+// reportOriginal calls OnOriginal, if set, with the path and the original
+// value of a field being scrubbed.
+func reportOriginal(path, value string) {
+	if OnOriginal != nil {
+		OnOriginal(path, value)
+	}
+}
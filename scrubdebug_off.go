@@ -0,0 +1,14 @@
+//go:build !scrubdebug
+
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+// reportOriginal does nothing without the "scrubdebug" build tag.
+// See scrubdebug.go.
+func reportOriginal(path, value string) {}
@@ -0,0 +1,44 @@
+//go:build scrubdebug
+
+package scrub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScrubOnOriginal tests the debug hook reporting the original values.
+func TestScrubOnOriginal(t *testing.T) {
+	originals := make(map[string]string)
+	OnOriginal = func(path, value string) {
+		originals[path] = value
+	}
+	defer func() { OnOriginal = nil }()
+
+	users := &Users{
+		Secret: "secret_sshhh",
+		UserInfo: []User{
+			{
+				Username: "John Doe",
+				Password: "John_Doe's_Password",
+			},
+		},
+	}
+
+	batch := &Batch{
+		Records: []json.RawMessage{
+			json.RawMessage(`{"user":{"password":"raw_password"}}`),
+		},
+	}
+
+	Scrub(users, map[string]bool{"password": true, "secret": true})
+	Scrub(batch, nil)
+
+	assert.Equal(t, map[string]string{
+		"Secret":                   "secret_sshhh",
+		"UserInfo[0].Password":     "John_Doe's_Password",
+		"Records[0].user.password": "raw_password",
+	}, originals)
+}
@@ -0,0 +1,18 @@
+module github.com/ssrathi/go-scrub/scrubzap
+
+go 1.18
+
+require (
+	github.com/ssrathi/go-scrub v1.0.0
+	github.com/stretchr/testify v1.7.1
+	go.uber.org/zap v1.21.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
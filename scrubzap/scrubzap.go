@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+// Package scrubzap logs values scrubbed by a scrub.Scrubber with zap. It is a
+// module of its own, so that the users of scrub alone don't depend on zap.
+package scrubzap
+
+import (
+	"encoding/json"
+
+	scrub "github.com/ssrathi/go-scrub"
+	"go.uber.org/zap"
+)
+
+// Field scrubs 'val' with 's' and returns it as a zap field named 'key', so
+// that a struct can be logged with zap without marshalling it manually. The
+// scrubbed JSON is embedded as is by zap's reflection-based encoding,
+// whatever the data type 's' is configured with.
+// If scrubbing fails, the field carries the error instead of 'val'.
+func Field(s *scrub.Scrubber, key string, val interface{}) zap.Field {
+	out, err := s.ScrubAs(val, scrub.JSONScrub)
+	if err != nil {
+		return zap.NamedError(key, err)
+	}
+
+	return zap.Reflect(key, json.RawMessage(out))
+}
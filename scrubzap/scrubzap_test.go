@@ -0,0 +1,51 @@
+package scrubzap
+
+import (
+	"encoding/json"
+	"testing"
+
+	scrub "github.com/ssrathi/go-scrub"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Struct with a password
+type User struct {
+	Username  string
+	Password  string
+	DbSecrets []string
+}
+
+// TestField tests logging a scrubbed struct with zap.
+func TestField(t *testing.T) {
+	user := &User{
+		Username:  "Shyam Rathi",
+		Password:  "nutanix/4u",
+		DbSecrets: []string{"db_secret_1", "db_secret_2"},
+	}
+
+	userScrubbed := &User{
+		Username:  "Shyam Rathi",
+		Password:  "********",
+		DbSecrets: []string{"db_secret_1", "db_secret_2"},
+	}
+
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	s := scrub.NewScrubber(nil)
+	logger.Info("login", Field(s, "user", user))
+
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+
+	fields := entries[0].ContextMap()
+	b, _ := json.Marshal(fields["user"])
+	want, _ := json.Marshal(userScrubbed)
+	assert.JSONEq(t, string(want), string(b))
+	assert.NotContains(t, string(b), "nutanix/4u")
+
+	// The logged struct is left untouched.
+	assert.Equal(t, "nutanix/4u", user.Password)
+}
@@ -0,0 +1,259 @@
+//go:build go1.21
+
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+)
+
+// scrubHandler is a slog.Handler scrubbing the attributes of the records
+// before passing them to the next handler, see NewScrubHandler.
+type scrubHandler struct {
+	next slog.Handler
+	// State every scrubbing starts from, with the fields to scrub and the
+	// options resolved once.
+	base *scrubState
+	// Groups opened with WithGroup, and the path of their attributes.
+	groups []string
+	path   string
+}
+
+// NewScrubHandler returns a slog.Handler which scrubs the attributes of every
+// record with the configuration of 's', before passing the record to 'next'.
+// Attribute keys are the field names: string attributes and the fields of
+// struct-valued ones are scrubbed at any level, including in groups.
+// Attributes added with WithAttrs are scrubbed once, when they are added.
+// Values which can't be scrubbed are masked fully. The fields to scrub,
+// including FieldGroups, are resolved when the handler is created.
+//
+// This is only built with Go 1.21 or later, which provides log/slog.
+func NewScrubHandler(next slog.Handler, s *Scrubber) slog.Handler {
+	return &scrubHandler{
+		next: next,
+		base: newScrubState(s.fieldsToScrub, s.opts),
+	}
+}
+
+// Enabled reports whether the next handler handles records at 'level'.
+func (h *scrubHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle scrubs the attributes of 'r' and passes it to the next handler.
+func (h *scrubHandler) Handle(ctx context.Context, r slog.Record) error {
+	scrubbed := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	scrubbed.AddAttrs(h.scrubAttrs(attrs)...)
+
+	return h.next.Handle(ctx, scrubbed)
+}
+
+// WithAttrs returns a handler passing the scrubbed 'attrs' to the next
+// handler's WithAttrs.
+func (h *scrubHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithAttrs(h.scrubAttrs(attrs))
+	return &h2
+}
+
+// WithGroup returns a handler scrubbing the attributes in the group 'name'.
+func (h *scrubHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	h2.path = fieldPath(h.path, name)
+	return &h2
+}
+
+// scrubAttrs returns the scrubbed copies of 'attrs', which are in the groups
+// of the handler.
+func (h *scrubHandler) scrubAttrs(attrs []slog.Attr) []slog.Attr {
+	base := *h.base
+	state := &base
+	for i, group := range h.groups {
+		state.depth = i
+		defer state.enterSubtree(group)()
+	}
+	state.depth = len(h.groups) - 1
+	state.names = append(state.names, h.groups...)
+	defer enterAttrSiblings(attrs, state)()
+
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		scrubbed[i] = scrubAttr(a, h.path, state)
+	}
+
+	return scrubbed
+}
+
+// scrubAttr returns a scrubbed copy of the attribute 'a' at 'path', the path
+// of its group, with 'state'. It is the counterpart of scrubInternal for
+// attributes: their keys take the role of the field names.
+func scrubAttr(a slog.Attr, path string, state *scrubState) slog.Attr {
+	if a.Key != "" {
+		path = fieldPath(path, a.Key)
+	}
+
+	state.depth++
+	state.names = append(state.names, a.Key)
+	defer func() {
+		state.names = state.names[:len(state.names)-1]
+		state.depth--
+	}()
+
+	defer state.enterKey(a.Key, false)()
+
+	leave := state.enterSubtree(a.Key)
+	defer leave()
+
+	value := a.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		attrs := value.Group()
+		defer enterAttrSiblings(attrs, state)()
+		scrubbed := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			scrubbed[i] = scrubAttr(attr, path, state)
+		}
+
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(scrubbed...)}
+
+	case slog.KindString:
+		if value.String() == "" {
+			break
+		}
+
+		if fieldOpts, ok := state.stringOptions(a.Key, value.String()); ok {
+			state.report(path, value.String())
+			return slog.String(a.Key, maskValue(value.String(), fieldOpts, path, state))
+		}
+
+		if masked, ok := state.maskMatches(a.Key, value.String()); ok {
+			state.report(path, value.String())
+			return slog.String(a.Key, masked)
+		}
+
+	case slog.KindAny:
+		return slog.Attr{Key: a.Key, Value: scrubAnyValue(value.Any(), a.Key, path, state)}
+	}
+
+	return slog.Attr{Key: a.Key, Value: value}
+}
+
+// enterAttrSiblings is like scrubState.enterSiblings for the attributes
+// 'attrs' of a group, which are the siblings of one another.
+func enterAttrSiblings(attrs []slog.Attr, state *scrubState) func() {
+	if !state.conditional {
+		return func() {}
+	}
+
+	siblings := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		if value := a.Value.Resolve(); value.Kind() == slog.KindString {
+			siblings[state.opts.fold(a.Key)] = value.String()
+		}
+	}
+
+	prev := state.siblings
+	state.siblings = siblings
+	return func() { state.siblings = prev }
+}
+
+// scrubAnyValue returns the value 'v' of the attribute 'key' at 'path',
+// scrubbed with 'state'. Unless nothing in it is scrubbed, the value is
+// returned as its scrubbed JSON, as 'v' is restored afterwards.
+func scrubAnyValue(v any, key, path string, state *scrubState) slog.Value {
+	if v == nil {
+		return slog.AnyValue(v)
+	}
+
+	if err, ok := v.(error); ok {
+		if fieldOpts, ok := state.leafOptions(key); ok {
+			state.report(path, err.Error())
+			return slog.AnyValue(scrubError(err, fieldOpts, path, state))
+		}
+	}
+
+	// Scrub the value with a state of its own, so that it can be restored
+	// on its own once marshalled. The value is marshalled as JSON, with the
+	// scrubbed outputs of its json.Marshaler values substituted.
+	valueState := *state
+	valueState.restoreFuncs = nil
+	valueState.names = append([]string(nil), state.names...)
+	valueState.substitutes = true
+	valueState.substitutions, valueState.jsonPath = nil, nil
+	valueState.marshaling, valueState.marshaled = 0, nil
+
+	target := reflect.New(reflect.TypeOf(v))
+	target.Elem().Set(reflect.ValueOf(v))
+	scrubInternal(target.Interface(), key, path, &valueState)
+	if valueState.err == nil && len(valueState.restoreFuncs) == 0 &&
+		len(valueState.substitutions) == 0 {
+		return slog.AnyValue(v)
+	}
+
+	var b []byte
+	err := valueState.err
+	if err == nil {
+		var buf bytes.Buffer
+		err = encode(&buf, target.Interface(), JSONScrub)
+		b = buf.Bytes()
+		if err == nil && len(valueState.substitutions) > 0 {
+			b = substituteJSON(b, valueState.substitutions)
+		}
+	}
+	valueState.restore()
+
+	if err != nil {
+		return slog.StringValue(defaultMask)
+	}
+
+	return slog.AnyValue(json.RawMessage(b))
+}
+
+// logValuer is a slog.LogValuer scrubbing its value, see ScrubValuer.
+type logValuer struct {
+	target interface{}
+	s      *Scrubber
+}
+
+// ScrubValuer returns a slog.LogValuer of 'target' which is resolved to its
+// JSON, scrubbed with 'fieldsToScrub' and 'opts' like ScrubFields, when it is
+// logged, e.g. slog.Any("req", scrub.ScrubValuer(req, nil)). Unlike a
+// scrubbing handler, it scrubs the value whatever the handler it is logged
+// with. A value which can't be scrubbed is masked fully.
+//
+// This is only built with Go 1.21 or later, which provides log/slog.
+func ScrubValuer(target interface{}, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) slog.LogValuer {
+	return logValuer{target: target, s: NewScrubber(fieldsToScrub, opts...)}
+}
+
+// LogValue implements slog.LogValuer.
+func (v logValuer) LogValue() slog.Value {
+	out, err := v.s.ScrubAs(v.target, JSONScrub)
+	if err != nil {
+		return slog.StringValue(defaultMask)
+	}
+
+	return slog.AnyValue(json.RawMessage(out))
+}
@@ -0,0 +1,138 @@
+//go:build go1.21
+
+package scrub
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestHandler returns a handler writing JSON records without their time
+// to 'buf'.
+func newTestHandler(buf *bytes.Buffer) slog.Handler {
+	return slog.NewJSONHandler(buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	})
+}
+
+// newTestLogger returns a logger writing JSON records without their time
+// to 'buf', through a scrubbing handler configured with 's'.
+func newTestLogger(buf *bytes.Buffer, s *Scrubber) *slog.Logger {
+	return slog.New(NewScrubHandler(newTestHandler(buf), s))
+}
+
+// TestScrubHandler tests scrubbing the attributes of log records.
+func TestScrubHandler(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScrubber(map[string]FieldScrubOptioner{"password": nil, "token": nil, "err": nil})
+	logger := newTestLogger(&buf, s)
+
+	user := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	logger.Info("login",
+		"user", user,
+		"password", "hunter2",
+		"err", errors.New("bad token hunter2"),
+		slog.Group("request", "token", "abc", "id", 42),
+		"attempts", 3)
+
+	assert.JSONEq(t, `{"level":"INFO","msg":"login",`+
+		`"user":{"Username":"John Doe","Password":"********","DbSecrets":null},`+
+		`"password":"********","err":"********",`+
+		`"request":{"token":"********","id":42},"attempts":3}`, buf.String())
+
+	// The original values must be restored after logging.
+	assert.Equal(t, "John_Doe's_Password", user.Password)
+}
+
+// TestScrubHandlerMarshaler tests scrubbing the output of the MarshalJSON
+// methods of attribute values.
+func TestScrubHandlerMarshaler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf, NewScrubber(map[string]FieldScrubOptioner{"password": nil}))
+
+	conn := &Endpoint{Host: "db.example.com", Passport: Passport{user: "admin", secret: "x"}}
+	logger.Info("connect", "conn", conn, "passport", Passport{user: "root", secret: "hunter2"})
+
+	assert.JSONEq(t, `{"level":"INFO","msg":"connect",`+
+		`"conn":{"Host":"db.example.com",`+
+		`"Passport":{"password":"********","username":"admin"},"Backup":null,"Note":""},`+
+		`"passport":{"password":"********","username":"root"}}`, buf.String())
+	assert.Equal(t, "x", conn.Passport.secret)
+}
+
+// TestScrubHandlerWithAttrs tests scrubbing the attributes added to a handler
+// and the attributes in its groups.
+func TestScrubHandlerWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScrubber(map[string]FieldScrubOptioner{
+		"password": nil,
+		"secrets":  NewMask().MaskSubtree(true),
+	})
+
+	logger := newTestLogger(&buf, s).With("password", "hunter2").
+		WithGroup("secrets").With("db", "pass1").WithGroup("api")
+	logger.Info("connect", "key", "pass2", "keys", []string{"pass3"})
+
+	assert.JSONEq(t, `{"level":"INFO","msg":"connect","password":"********",`+
+		`"secrets":{"db":"********","api":{"key":"********","keys":["********"]}}}`,
+		buf.String())
+}
+
+// TestScrubHandlerQualified tests scrubbing attributes by path-qualified
+// names and depending on their siblings.
+func TestScrubHandlerQualified(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScrubber(map[string]FieldScrubOptioner{
+		"db.password": nil,
+		"token": NewMask().When(func(siblings map[string]string) bool {
+			return siblings["env"] == "prod"
+		}),
+	})
+	logger := newTestLogger(&buf, s)
+
+	logger.Info("connect", "password", "hunter1",
+		slog.Group("db", "password", "hunter2"),
+		"env", "prod", "token", "abc",
+		slog.Group("dev", "env", "dev", "token", "def"))
+	assert.JSONEq(t, `{"level":"INFO","msg":"connect","password":"hunter1",`+
+		`"db":{"password":"********"},`+
+		`"env":"prod","token":"********","dev":{"env":"dev","token":"def"}}`, buf.String())
+
+	buf.Reset()
+	logger.WithGroup("db").Info("connect", "password", "hunter2")
+	assert.JSONEq(t, `{"level":"INFO","msg":"connect","db":{"password":"********"}}`, buf.String())
+
+	// The fields of struct-valued attributes are qualified by their keys.
+	buf.Reset()
+	logger.Info("connect", "db", &User{Password: "hunter2"}, "user", &User{Password: "hunter3"})
+	assert.JSONEq(t, `{"level":"INFO","msg":"connect",`+
+		`"db":{"Username":"","Password":"********","DbSecrets":null},`+
+		`"user":{"Username":"","Password":"hunter3","DbSecrets":null}}`, buf.String())
+}
+
+// TestScrubValuerLogValue tests scrubbing values when they are logged.
+func TestScrubValuerLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newTestHandler(&buf))
+
+	user := &User{Username: "John Doe", Password: "John_Doe's_Password"}
+	logger.Info("login", "user", ScrubValuer(user, nil),
+		"bad", ScrubValuer(make(chan int), nil))
+
+	assert.JSONEq(t, `{"level":"INFO","msg":"login",`+
+		`"user":{"Username":"John Doe","Password":"********","DbSecrets":null},`+
+		`"bad":"********"}`, buf.String())
+
+	// The original values must be restored after logging.
+	assert.Equal(t, "John_Doe's_Password", user.Password)
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+)
+
+// valuerType is the type of database values, such as sql.NullString.
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// isValuer returns true if values of type 't' are database values scrubbed
+// by scrubValuer. Values of string kinds are scrubbed as strings instead.
+func isValuer(t reflect.Type) bool {
+	if t.Kind() == reflect.String || t.Kind() == reflect.Interface {
+		return false
+	}
+
+	return t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType)
+}
+
+// nullableValue returns the name and the value of the field holding the
+// value of the struct 'targetValue', if it has the shape of a nullable
+// wrapper such as sql.NullString or sql.Null[T]: a "Valid" boolean and
+// another exported field.
+func nullableValue(targetValue reflect.Value) (string, reflect.Value, bool) {
+	targetType := targetValue.Type()
+	if targetType.NumField() != 2 || !targetValue.CanAddr() {
+		return "", reflect.Value{}, false
+	}
+
+	for i, valid := range []int{1, 0} {
+		validType, valueType := targetType.Field(valid), targetType.Field(i)
+		if validType.Name == "Valid" && validType.Type.Kind() == reflect.Bool &&
+			valueType.IsExported() {
+			return valueType.Name, targetValue.Field(i), true
+		}
+	}
+
+	return "", reflect.Value{}, false
+}
+
+// scrubValuer scrubs the database value 'targetValue' at 'path', which
+// implements driver.Valuer, as per the field options 'fieldOpts'. If its
+// driver value is a string (or bytes), the masked string is written back
+// with its sql.Scanner implementation. It saves a function to restore the
+// original value in 'state'.
+//
+// Values which don't implement sql.Scanner can't be scrubbed and are left
+// as is; in strict mode, they stop the scrubbing with ErrNotScrubbable.
+func scrubValuer(targetValue reflect.Value, fieldOpts FieldScrubOptioner, path string,
+	state *scrubState) {
+	if !targetValue.CanAddr() || !targetValue.Addr().CanInterface() {
+		return
+	}
+
+	valuer, ok := targetValue.Addr().Interface().(driver.Valuer)
+	if !ok {
+		valuer = targetValue.Interface().(driver.Valuer)
+	}
+
+	value, err := valuer.Value()
+	if err != nil {
+		state.fail(fmt.Errorf("%w: %s: %v", ErrNotScrubbable, path, err))
+		return
+	}
+
+	var original string
+	switch v := value.(type) {
+	case string:
+		original = v
+	case []byte:
+		original = string(v)
+	default:
+		// Not a string, e.g. NULL or a number.
+		return
+	}
+
+	if original == "" {
+		return
+	}
+
+	scanner, ok := targetValue.Addr().Interface().(sql.Scanner)
+	if !ok || !targetValue.CanSet() {
+		state.fail(fmt.Errorf("%w: %s: %s doesn't implement sql.Scanner",
+			ErrNotScrubbable, path, targetValue.Type()))
+		return
+	}
+
+	saved := reflect.New(targetValue.Type()).Elem()
+	saved.Set(targetValue)
+	restore := func() { targetValue.Set(saved) }
+
+	var masked interface{} = maskValue(original, fieldOpts, path, state)
+	if _, ok := value.([]byte); ok {
+		masked = []byte(masked.(string))
+	}
+
+	if err := scanner.Scan(masked); err != nil {
+		restore()
+		state.fail(fmt.Errorf("%w: %s: %v", ErrNotScrubbable, path, err))
+		return
+	}
+
+	state.saveRestoreFunc(restore)
+	state.report(path, original)
+}
@@ -0,0 +1,50 @@
+//go:build go1.22
+
+package scrub
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+)
+
+// Secret is a string kind held by generic database values.
+type Secret string
+
+// Optional is a nullable wrapper of another package, with the same shape as sql.Null.
+type Optional[T any] struct {
+	Valid bool
+	Value T
+}
+
+// Struct with generic database values
+type NullConfig struct {
+	Host     string
+	Password sql.Null[string]
+	APIKey   sql.Null[Secret]
+	Token    sql.Null[string]
+	Port     sql.Null[int]
+	Backup   Optional[string]
+}
+
+// TestScrubNullGeneric tests scrubbing generic nullable values, whether or
+// not they are valid.
+func TestScrubNullGeneric(t *testing.T) {
+	cfg := &NullConfig{
+		Host:     "db.example.com",
+		Password: sql.Null[string]{V: "hunter2", Valid: true},
+		APIKey:   sql.Null[Secret]{V: "api_key", Valid: true},
+		Token:    sql.Null[string]{V: "stale", Valid: false},
+		Port:     sql.Null[int]{V: 5432, Valid: true},
+		Backup:   Optional[string]{Valid: true, Value: "backup_key"},
+	}
+
+	validateScrub(t, cfg, json.RawMessage(`{"Host":"db.example.com",`+
+		`"Password":{"V":"********","Valid":true},`+
+		`"APIKey":{"V":"********","Valid":true},`+
+		`"Token":{"V":"********","Valid":false},`+
+		`"Port":{"V":5432,"Valid":true},`+
+		`"Backup":{"Valid":true,"Value":"********"}}`), map[string]bool{
+		"password": true, "apikey": true, "token": true, "port": true, "backup": true,
+	})
+}
@@ -0,0 +1,86 @@
+package scrub
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SecretValue is a database value holding a secret in an unexported field.
+type SecretValue struct {
+	secret string
+}
+
+// Value implements driver.Valuer.
+func (v SecretValue) Value() (driver.Value, error) {
+	return v.secret, nil
+}
+
+// Scan implements sql.Scanner.
+func (v *SecretValue) Scan(src interface{}) error {
+	s, ok := src.(string)
+	if !ok {
+		return errors.New("not a string")
+	}
+
+	v.secret = s
+	return nil
+}
+
+// MarshalJSON marshals the secret, like a careless type would.
+func (v SecretValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.secret)
+}
+
+// ValueOnly is a database value which can't be scanned.
+type ValueOnly struct {
+	Secret string `json:"-"`
+}
+
+// Value implements driver.Valuer.
+func (v ValueOnly) Value() (driver.Value, error) {
+	return v.Secret, nil
+}
+
+// Struct with database values
+type DBConfig struct {
+	Host     string
+	DSN      SecretValue
+	Password sql.NullString
+	Token    *sql.NullString
+	APIKey   ValueOnly
+}
+
+// TestScrubValuer tests scrubbing database values through their driver values.
+func TestScrubValuer(t *testing.T) {
+	cfg := &DBConfig{
+		Host:     "db.example.com",
+		DSN:      SecretValue{secret: "postgres://admin:hunter2@db"},
+		Password: sql.NullString{String: "hunter2", Valid: true},
+		Token:    &sql.NullString{},
+	}
+
+	validateScrub(t, cfg, json.RawMessage(`{"Host":"db.example.com","DSN":"********",`+
+		`"Password":{"String":"********","Valid":true},`+
+		`"Token":{"String":"","Valid":false},"APIKey":{}}`),
+		map[string]bool{"dsn": true, "password": true, "token": true})
+
+	// Nil values are left as is.
+	cfg.Token = nil
+	got := Scrub(cfg, map[string]bool{"token": true})
+	assert.Contains(t, got, `"Token":null`)
+
+	// Values which can't be scanned are left as is, unless in strict mode.
+	cfg.APIKey.Secret = "api_key"
+	got = Scrub(cfg, map[string]bool{"apikey": true})
+	assert.Contains(t, got, `"APIKey":{}`)
+
+	_, err := NewScrubber(map[string]FieldScrubOptioner{"apikey": nil},
+		WithStrict(true)).Scrub(cfg)
+	assert.ErrorIs(t, err, ErrNotScrubbable)
+	assert.Contains(t, err.Error(), "APIKey")
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strategy masks a sensitive value in a specific way, set per field with
+// FieldScrubOptions.Strategy. It returns the masked value and true, or false
+// if it can't handle the given value, in which case the value is masked fully.
+type Strategy func(value string) (string, bool)
+
+// namedStrategies maps the names of the strategies usable in struct tags and
+// configuration files to the strategies.
+var namedStrategies = map[string]Strategy{
+	"jwt":    JWTSignatureMask,
+	"format": FormatPreservingMask,
+	"case":   CasePreservingMask,
+	"digest": DigestSuffixMask,
+}
+
+// JWTSignatureMask is a Strategy which masks only the signature of a JSON Web
+// Token, keeping its header and payload visible to debug its claims, e.g.
+// "eyJhbGciOi.eyJzdWIiOi.SflKxwRJSM" is masked to "eyJhbGciOi.eyJzdWIiOi.********".
+// Values which are not made of three dot-separated base64url segments are
+// masked fully.
+func JWTSignatureMask(value string) (string, bool) {
+	segments := strings.Split(value, ".")
+	if len(segments) != 3 {
+		return "", false
+	}
+
+	for _, segment := range segments {
+		if segment == "" {
+			return "", false
+		}
+
+		if _, err := base64.RawURLEncoding.DecodeString(segment); err != nil {
+			return "", false
+		}
+	}
+
+	return segments[0] + "." + segments[1] + "." + defaultMask, true
+}
+
+// FormatPreservingMask is a Strategy which masks every letter and digit of a
+// value with '*', keeping its other characters (spaces, punctuation, etc.),
+// so that the format of the value stays visible, e.g. "(555) 123-4567" is
+// masked to "(***) ***-****". Letters and digits of any script are masked,
+// e.g. the Arabic-Indic digits of "٠١٢-٣٤".
+func FormatPreservingMask(value string) (string, bool) {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return '*'
+		}
+
+		return r
+	}, value), true
+}
+
+// CasePreservingMask is a Strategy which masks every letter and digit of a
+// value with a symbol of the same class, keeping its other characters like
+// FormatPreservingMask: uppercase letters with 'X', lowercase letters with
+// 'x' and digits with '#', e.g. "Ab12-cD" is masked to "Xx##-xX". Letters
+// without case, as in "東京", are masked with '*'.
+func CasePreservingMask(value string) (string, bool) {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsUpper(r):
+			return 'X'
+		case unicode.IsLower(r):
+			return 'x'
+		case unicode.IsLetter(r):
+			return '*'
+		case unicode.IsDigit(r):
+			return '#'
+		}
+
+		return r
+	}, value), true
+}
+
+// SegmentMask returns a Strategy which masks every character of a value with
+// '*', except for the 'separator' characters, so that the segments of the
+// value stay visible, e.g. "AAAA-BBBB-CCCC" is masked to "****-****-****"
+// with '-' as the separator. It is a lighter form of FormatPreservingMask
+// for values with a known separator.
+func SegmentMask(separator rune) Strategy {
+	return func(value string) (string, bool) {
+		segments := strings.Split(value, string(separator))
+		for i, segment := range segments {
+			segments[i] = strings.Repeat("*", utf8.RuneCountInString(segment))
+		}
+
+		return strings.Join(segments, string(separator)), true
+	}
+}
+
+// CoarseTimeMask returns a Strategy which masks a time formatted with the
+// 'layout' of package time down to a coarser granularity, by formatting it
+// again with 'outputLayout', e.g. "2022-04-05T13:45:00Z" is masked to
+// "2022-04-05" with time.RFC3339 and "2006-01-02". The time is formatted in
+// its own location. Values which can't be parsed with 'layout' are masked
+// fully.
+func CoarseTimeMask(layout, outputLayout string) Strategy {
+	return func(value string) (string, bool) {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return "", false
+		}
+
+		return t.Format(outputLayout), true
+	}
+}
+
+// JoinKeyMask returns a Strategy which masks a value fully, followed by a
+// pseudonym of the value usable as a join key across redacted datasets, e.g.
+// "******** (pk:abcd1234)". The pseudonym is the first 'tagLen' hex characters
+// (8 if 'tagLen' is not positive, at most 64) of the HMAC-SHA256 of the value
+// keyed with 'key', so the same value always yields the same pseudonym, while
+// it can't be reversed without the key.
+func JoinKeyMask(key []byte, tagLen int) Strategy {
+	if tagLen <= 0 {
+		tagLen = 8
+	}
+
+	if tagLen > 2*sha256.Size {
+		tagLen = 2 * sha256.Size
+	}
+
+	return func(value string) (string, bool) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		tag := hex.EncodeToString(mac.Sum(nil))[:tagLen]
+
+		return defaultMask + " (pk:" + tag + ")", true
+	}
+}
+
+// DigestSuffixMask is a Strategy which masks a value fully, followed by the
+// first 8 hex characters of the SHA-256 digest of the value, e.g.
+// "********#f52fbd32", so that two redactions of the same value can be
+// compared. Unlike JoinKeyMask, the digest is not keyed: short or guessable
+// values can be found by hashing candidates.
+func DigestSuffixMask(value string) (string, bool) {
+	sum := sha256.Sum256([]byte(value))
+	return defaultMask + "#" + hex.EncodeToString(sum[:4]), true
+}
+
+// HashMask returns a Strategy which replaces a value by its hex-encoded
+// SHA-256 digest, so that the same value always yields the same result, e.g.
+// to tell whether two log lines reference the same secret. With a 'salt', the
+// digest is the HMAC-SHA256 of the value keyed with 'salt', so that it can't
+// be reversed by hashing candidate values without the salt, and differs
+// across deployments with different salts. The digest is truncated to its
+// first 'hexLen' hex characters if 'hexLen' is positive (at most 64).
+func HashMask(salt []byte, hexLen int) Strategy {
+	if hexLen <= 0 || hexLen > 2*sha256.Size {
+		hexLen = 2 * sha256.Size
+	}
+
+	return func(value string) (string, bool) {
+		var sum []byte
+		if len(salt) == 0 {
+			digest := sha256.Sum256([]byte(value))
+			sum = digest[:]
+		} else {
+			mac := hmac.New(sha256.New, salt)
+			mac.Write([]byte(value))
+			sum = mac.Sum(nil)
+		}
+
+		return hex.EncodeToString(sum)[:hexLen], true
+	}
+}
+
+// MaskFull returns a mask of 'n' symbols 'symbol', '*' if empty, like the
+// masks of values masked fully with WithMaskLenVary. A negative 'n' gives an
+// empty mask.
+func MaskFull(symbol string, n int) string {
+	if symbol == "" {
+		symbol = "*"
+	}
+
+	if n < 0 {
+		n = 0
+	}
+
+	return strings.Repeat(symbol, n)
+}
+
+// MaskBack is like MaskMiddle, keeping only the first 'visibleFront'
+// characters of 'value' visible.
+func MaskBack(value, symbol string, visibleFront int) string {
+	return MaskMiddle(value, symbol, visibleFront, 0)
+}
+
+// MaskMiddle masks a standalone 'value' as a field is masked with
+// WithAlwaysShowFirst('visibleFront'), WithAlwaysShowLast('visibleBack') and
+// WithMaskLenVary: its first and last characters stay visible and each other
+// character is replaced by 'symbol' ('*' if empty), e.g. "hunter2" is masked
+// to "hu****2". Negative counts are taken as 0. Like a field, a value which
+// is not longer than twice its visible characters is masked fully, so that
+// short values are not revealed.
+func MaskMiddle(value, symbol string, visibleFront, visibleBack int) string {
+	if visibleFront < 0 {
+		visibleFront = 0
+	}
+
+	if visibleBack < 0 {
+		visibleBack = 0
+	}
+
+	runes := []rune(value)
+	n := visibleFront + visibleBack
+	if n == 0 || len(runes) <= 2*n {
+		return MaskFull(symbol, len(runes))
+	}
+
+	return string(runes[:visibleFront]) + MaskFull(symbol, len(runes)-n) +
+		string(runes[len(runes)-visibleBack:])
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// enterTaggedField starts scrubbing the struct field 'field' as per its
+// "scrub" tag 'tag' (see structTags), if any, so that sensitive fields can be
+// marked in their struct definitions rather than in the fields to scrub. It
+// returns a function to call when leaving the field.
+//
+// The tag is "mask", optionally followed by comma-separated options:
+//
+//	Password string `scrub:"mask"`
+//	Token    string `scrub:"mask,token=<jwt>"`
+//	Session  string `scrub:"mask,strategy=jwt"`
+//	Card     string `scrub:"mask,partial=6:4,symbol=#"`
+//	Profile  Info   `scrub:"mask,subtree"`
+//	PIN      int    `scrub:"mask,nonstring"`
+//	Debug    string `scrub:"mask,drop"`
+//
+// "token", "symbol", "subtree", "nonstring" and "drop" set
+// FieldScrubOptions.Token, Symbol, MaskSubtree, ScrubNonString and Drop, and
+// "strategy" sets Strategy to JWTSignatureMask ("jwt"), FormatPreservingMask
+// ("format"), CasePreservingMask ("case") or DigestSuffixMask ("digest").
+// "partial=F:B" sets ShowFirst to F and ShowLast to B, and "partial" alone
+// keeps the last 4 characters visible, as usual for card numbers. If the
+// field is also in the fields to scrub, its options there take precedence
+// over the tag.
+//
+// A tag with an unknown option or strategy, or an invalid "partial", still
+// masks the field, ignoring the option, but it fails the scrubbing in strict
+// mode. Scrubber.Validate reports such tags.
+func (s *scrubState) enterTaggedField(field string, tag fieldTag) func() {
+	if tag.err != nil {
+		s.fail(fmt.Errorf("%w: field %s: %v", ErrInvalidConfig, field, tag.err))
+	}
+
+	if !tag.ok && s.tagOpts == nil {
+		// Neither this field nor the one holding it is tagged.
+		return func() {}
+	}
+
+	taggedField, tagOpts := s.taggedField, s.tagOpts
+	leave := func() { s.taggedField, s.tagOpts = taggedField, tagOpts }
+
+	s.taggedField, s.tagOpts = "", nil
+	if tag.ok {
+		s.taggedField, s.tagOpts = field, tag.opts
+	}
+
+	return leave
+}
+
+// fieldTag is the "scrub" tag of a struct field, as returned by parseTag.
+type fieldTag struct {
+	opts *FieldScrubOptions
+	ok   bool
+	err  error
+}
+
+// structFieldTags caches the result of structTags by struct type.
+var structFieldTags sync.Map
+
+// structTags returns the "scrub" tags of the fields of 'structType', parsed
+// once per type.
+func structTags(structType reflect.Type) []fieldTag {
+	if tags, ok := structFieldTags.Load(structType); ok {
+		return tags.([]fieldTag)
+	}
+
+	tags := make([]fieldTag, structType.NumField())
+	for i := range tags {
+		tag := &tags[i]
+		tag.opts, tag.ok, tag.err = parseTag(structType.Field(i).Tag.Get("scrub"))
+	}
+	structFieldTags.Store(structType, tags)
+
+	return tags
+}
+
+// parseTag returns the options set by the "scrub" struct tag 'tag', or false
+// if it doesn't mark a field to scrub. See enterTaggedField for its syntax.
+// It also returns an error describing the first invalid option, if any,
+// along with the options set by the valid ones.
+func parseTag(tag string) (*FieldScrubOptions, bool, error) {
+	parts := strings.Split(tag, ",")
+	if parts[0] != "mask" {
+		return nil, false, nil
+	}
+
+	var err error
+	invalid := func(format string, args ...interface{}) {
+		if err == nil {
+			err = fmt.Errorf(format, args...)
+		}
+	}
+
+	fieldOpts := &FieldScrubOptions{}
+	for _, part := range parts[1:] {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "token":
+			fieldOpts.Token = value
+		case "strategy":
+			strategy, ok := namedStrategies[value]
+			if !ok {
+				invalid("unknown strategy %q", value)
+			}
+			fieldOpts.Strategy = strategy
+		case "symbol":
+			fieldOpts.Symbol = value
+		case "partial":
+			first, last, ok := parsePartial(part)
+			if !ok {
+				invalid("invalid partial option %q", part)
+			}
+			fieldOpts.ShowFirst, fieldOpts.ShowLast = first, last
+		case "subtree":
+			fieldOpts.MaskSubtree = true
+		case "nonstring":
+			fieldOpts.ScrubNonString = true
+		case "drop":
+			fieldOpts.Drop = true
+		default:
+			invalid("unknown option %q", part)
+		}
+	}
+
+	return fieldOpts, true, err
+}
+
+// parsePartial returns the numbers of visible first and last characters set
+// by the "partial" tag option 'option', or false if it is invalid.
+func parsePartial(option string) (first, last int, ok bool) {
+	_, value, found := strings.Cut(option, "=")
+	if !found {
+		return 0, 4, true
+	}
+
+	f, l, found := strings.Cut(value, ":")
+	if !found {
+		return 0, 0, false
+	}
+
+	first, err := strconv.Atoi(f)
+	if err != nil || first < 0 {
+		return 0, 0, false
+	}
+
+	last, err = strconv.Atoi(l)
+	if err != nil || last < 0 {
+		return 0, 0, false
+	}
+
+	return first, last, true
+}
+
+// tagProblems appends to 'problems' the invalid "scrub" tags of the struct
+// fields of 'typ' and of the types it refers to, which are added to 'seen'.
+func tagProblems(typ reflect.Type, seen map[reflect.Type]bool, problems []string) []string {
+	if typ == nil || seen[typ] {
+		return problems
+	}
+	seen[typ] = true
+
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return tagProblems(typ.Elem(), seen, problems)
+	case reflect.Map:
+		return tagProblems(typ.Elem(), seen, problems)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if _, _, err := parseTag(field.Tag.Get("scrub")); err != nil {
+				problems = append(problems,
+					fmt.Sprintf("type %v: field %s: %v", typ, field.Name, err))
+			}
+
+			problems = tagProblems(field.Type, seen, problems)
+		}
+	}
+
+	return problems
+}
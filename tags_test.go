@@ -0,0 +1,158 @@
+package scrub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Struct with fields marked sensitive by their tags
+type Profile struct {
+	Name    string
+	Email   string   `scrub:"mask,strategy=format"`
+	PIN     string   `scrub:"mask,token=<pin>"`
+	Session string   `scrub:"mask,strategy=jwt"`
+	Codes   []string `scrub:"mask"`
+	Address Address  `scrub:"mask,subtree"`
+	Notes   string   `scrub:"-"`
+	Friend  *Profile
+}
+
+// Struct nested in a tagged field
+type Address struct {
+	Street string
+	City   string
+}
+
+// TestScrubTags tests scrubbing fields marked by their struct tags.
+func TestScrubTags(t *testing.T) {
+	profile := &Profile{
+		Name:    "John Doe",
+		Email:   "john@example.com",
+		PIN:     "1234",
+		Session: "aGVhZGVy.cGF5bG9hZA.c2ln",
+		Codes:   []string{"code1", "code2"},
+		Address: Address{Street: "1 Main St", City: "Springfield"},
+		Notes:   "public",
+		Friend:  &Profile{Name: "Jane Doe", PIN: "5678"},
+	}
+
+	profileScrubbed := &Profile{
+		Name:    "John Doe",
+		Email:   "****@*******.***",
+		PIN:     "<pin>",
+		Session: "aGVhZGVy.cGF5bG9hZA.********",
+		Codes:   []string{"********", "********"},
+		Address: Address{Street: "********", City: "********"},
+		Notes:   "public",
+		Friend:  &Profile{Name: "Jane Doe", PIN: "<pin>"},
+	}
+
+	validateScrubFields(t, profile, profileScrubbed, map[string]FieldScrubOptioner{})
+}
+
+// TestScrubTagsPrecedence tests that the fields to scrub take precedence over
+// struct tags, and that excluded fields are not scrubbed.
+func TestScrubTagsPrecedence(t *testing.T) {
+	profile := &Profile{Name: "John Doe", PIN: "1234", Codes: []string{"code1"}}
+
+	got := ScrubFields(profile, map[string]FieldScrubOptioner{
+		"pin": NewMask().Token("<secret>"),
+	}, WithExcludedFields("codes"))
+
+	want, _ := json.Marshal(&Profile{Name: "John Doe", PIN: "<secret>", Codes: []string{"code1"}})
+	assert.Equal(t, string(want), got)
+}
+
+// TestParseTag tests parsing "scrub" struct tags.
+func TestParseTag(t *testing.T) {
+	for _, tag := range []string{"", "-", "omit", "masked,token=x"} {
+		_, ok, err := parseTag(tag)
+		assert.False(t, ok, "tag %q", tag)
+		assert.NoError(t, err, "tag %q", tag)
+	}
+
+	fieldOpts, ok, err := parseTag("mask,token=[REDACTED],subtree,nonstring")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, &FieldScrubOptions{
+		Token:          "[REDACTED]",
+		MaskSubtree:    true,
+		ScrubNonString: true,
+	}, fieldOpts)
+
+	fieldOpts, ok, err = parseTag("mask,strategy=case")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.NotNil(t, fieldOpts.Strategy)
+
+	fieldOpts, ok, err = parseTag("mask,drop")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, &FieldScrubOptions{Drop: true}, fieldOpts)
+
+	fieldOpts, ok, err = parseTag("mask,partial=6:4,symbol=#")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, &FieldScrubOptions{Symbol: "#", ShowFirst: 6, ShowLast: 4}, fieldOpts)
+
+	fieldOpts, _, err = parseTag("mask,partial")
+	assert.NoError(t, err)
+	assert.Equal(t, &FieldScrubOptions{ShowLast: 4}, fieldOpts)
+
+	// Invalid options are reported, while the valid ones are kept.
+	for tag, want := range map[string]string{
+		"mask,token=x,unknown=1":    `unknown option "unknown=1"`,
+		"mask,token=x,strategy=jtw": `unknown strategy "jtw"`,
+		"mask,token=x,partial=6":    `invalid partial option "partial=6"`,
+		"mask,token=x,partial=a:4":  `invalid partial option "partial=a:4"`,
+		"mask,token=x,partial=-1:4": `invalid partial option "partial=-1:4"`,
+	} {
+		fieldOpts, ok, err = parseTag(tag)
+		assert.True(t, ok, "tag %q", tag)
+		assert.EqualError(t, err, want, "tag %q", tag)
+		assert.Equal(t, "x", fieldOpts.Token, "tag %q", tag)
+	}
+}
+
+// Struct with a card number masked partially by its tag
+type Payment struct {
+	Card   string `scrub:"mask,partial=2:4,symbol=#"`
+	Amount int
+}
+
+// Struct with a mistyped tag
+type Signin struct {
+	User    string
+	Session string `scrub:"mask,strategy=jtw"`
+}
+
+// TestScrubTagsPartial tests masking fields partially with their own symbol
+// as per their tags.
+func TestScrubTagsPartial(t *testing.T) {
+	payment := &Payment{Card: "4111111111111111", Amount: 10}
+	got := ScrubFields(payment, map[string]FieldScrubOptioner{})
+	assert.Equal(t, `{"Card":"41########1111","Amount":10}`, got)
+}
+
+// TestScrubTagsInvalid tests scrubbing fields with invalid tags, and finding
+// those with Scrubber.Validate.
+func TestScrubTagsInvalid(t *testing.T) {
+	login := &Signin{User: "john", Session: "aGVhZGVy.cGF5bG9hZA.c2ln"}
+
+	// The field is still masked, fully.
+	got := ScrubFields(login, map[string]FieldScrubOptioner{})
+	assert.Equal(t, `{"User":"john","Session":"********"}`, got)
+
+	_, err := ScrubE(login, map[string]FieldScrubOptioner{}, WithStrict(true))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.EqualError(t, err, `scrub: invalid config: field Session: unknown strategy "jtw"`)
+
+	s := NewScrubber(nil)
+	assert.NoError(t, s.Validate(&Payment{}, []Profile{}))
+	err = s.Validate(&Payment{}, map[string][]*Signin{})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.EqualError(t, err, "scrub: invalid config: "+
+		`type scrub.Signin: field Session: unknown strategy "jtw"`)
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"reflect"
+	"time"
+)
+
+// timeType is the type of times, which are scrubbed by scrubTime.
+var timeType = reflect.TypeOf(time.Time{})
+
+// scrubTime scrubs the time 'targetValue' at 'path' as per the field options
+// 'fieldOpts': it is truncated as per FieldScrubOptions.Truncate, or zeroed.
+// It saves a function to restore the original time in 'state'.
+func scrubTime(targetValue reflect.Value, fieldOpts FieldScrubOptioner, path string,
+	state *scrubState) {
+	if !targetValue.CanSet() || targetValue.IsZero() {
+		return
+	}
+
+	original := targetValue.Interface().(time.Time)
+	state.saveRestoreFunc(func() { targetValue.Set(reflect.ValueOf(original)) })
+	state.report(path, original.String())
+
+	var scrubbed time.Time
+	if d := fieldOptions(fieldOpts).Truncate; d > 0 {
+		scrubbed = original.Truncate(d)
+	}
+
+	targetValue.Set(reflect.ValueOf(scrubbed))
+}
@@ -0,0 +1,41 @@
+package scrub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Struct with times
+type Appointment struct {
+	Doctor   string
+	Birthday time.Time
+	Visit    *time.Time
+	Created  time.Time
+}
+
+// TestScrubTime tests scrubbing times to coarser values.
+func TestScrubTime(t *testing.T) {
+	birthday := time.Date(1990, time.May, 4, 0, 0, 0, 0, time.UTC)
+	visit := time.Date(2022, time.April, 5, 13, 45, 30, 0, time.UTC)
+	created := time.Date(2022, time.April, 1, 9, 0, 0, 0, time.UTC)
+	appointment := &Appointment{
+		Doctor:   "Dr. Who",
+		Birthday: birthday,
+		Visit:    &visit,
+		Created:  created,
+	}
+
+	got := ScrubFields(appointment, map[string]FieldScrubOptioner{
+		"birthday": nil,
+		"visit":    NewMask().Truncate(24 * time.Hour),
+		"created":  NewMask().Truncate(time.Hour),
+	})
+	assert.Equal(t, `{"Doctor":"Dr. Who","Birthday":"0001-01-01T00:00:00Z",`+
+		`"Visit":"2022-04-05T00:00:00Z","Created":"2022-04-01T09:00:00Z"}`, got)
+
+	// The original times must be restored after scrubbing.
+	assert.Equal(t, birthday, appointment.Birthday)
+	assert.Equal(t, visit, *appointment.Visit)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2022 Nutanix Inc. All rights reserved.
+ *
+ * Author: Shyamsunder Rathi - shyam.rathi@nutanix.com
+ * MIT License
+ */
+
+package scrub
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// xmlElement is an element being scrubbed by ScrubXML.
+type xmlElement struct {
+	name  string
+	path  string
+	leave func()
+}
+
+// ScrubXML scrubs the XML document read from 'r' and writes it to 'w',
+// without a Go struct: the names of the elements and of the attributes take
+// the role of the field names. It streams the document token by token, so
+// that large documents are not loaded in memory at once. The text of the
+// elements to scrub, and the attributes to scrub, are masked; elements
+// nested in an element to scrub are only masked if they are to be scrubbed
+// themselves, or if it is scrubbed with FieldScrubOptions.MaskSubtree. The
+// output is equivalent XML, but it is not byte for byte the same as the
+// input, e.g. namespaces are declared on each element using them. It returns
+// the error of reading or writing the document, if any.
+func ScrubXML(w io.Writer, r io.Reader, fieldsToScrub map[string]FieldScrubOptioner,
+	opts ...Option) error {
+	state := newScrubState(fieldsToScrub, opts)
+	decoder := xml.NewDecoder(r)
+	encoder := xml.NewEncoder(w)
+
+	var elements []xmlElement
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			path := t.Name.Local
+			if len(elements) > 0 {
+				path = fieldPath(elements[len(elements)-1].path, t.Name.Local)
+			}
+
+			// The children of the root element are at depth 0, like the
+			// fields of a struct.
+			state.depth = len(elements) - 1
+			leave := state.enterSubtree(t.Name.Local)
+			elements = append(elements, xmlElement{name: t.Name.Local, path: path, leave: leave})
+
+			// Attributes are one level below their element.
+			state.depth++
+			attrs := make([]xml.Attr, len(t.Attr))
+			for i, attr := range t.Attr {
+				attrs[i] = attr
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+
+				attrs[i].Value = scrubText(attr.Value, attr.Name.Local,
+					fieldPath(path, attr.Name.Local), state)
+			}
+			state.depth--
+			t.Attr = attrs
+			token = t
+
+		case xml.EndElement:
+			if len(elements) > 0 {
+				elements[len(elements)-1].leave()
+				elements = elements[:len(elements)-1]
+				state.depth = len(elements) - 2
+			}
+
+		case xml.CharData:
+			if len(elements) > 0 {
+				element := elements[len(elements)-1]
+				token = xml.CharData(scrubText(string(t), element.name, element.path, state))
+			}
+		}
+
+		if err := encoder.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+
+	return encoder.Flush()
+}
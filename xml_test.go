@@ -0,0 +1,97 @@
+package scrub
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScrubXML tests scrubbing XML documents without a Go struct.
+func TestScrubXML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<users>
+  <!-- accounts -->
+  <user id="1" token="tok_1">
+    <name>John Doe</name>
+    <password>hunter2</password>
+    <keys><key>k1</key><key>k2</key></keys>
+  </user>
+  <secrets><db>pass1</db><api><key>pass2</key></api></secrets>
+  <password></password>
+</users>`
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<users>
+  <!-- accounts -->
+  <user id="1" token="********">
+    <name>John Doe</name>
+    <password>********</password>
+    <keys><key>k1</key><key>k2</key></keys>
+  </user>
+  <secrets><db>********</db><api><key>********</key></api></secrets>
+  <password></password>
+</users>`
+
+	var out bytes.Buffer
+	err := ScrubXML(&out, strings.NewReader(input), map[string]FieldScrubOptioner{
+		"password": nil,
+		"token":    nil,
+		"secrets":  NewMask().MaskSubtree(true),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, want, out.String())
+
+	// Only the top-level passwords are scrubbed at depth 0.
+	out.Reset()
+	err = ScrubXML(&out, strings.NewReader(input), nil, WithDepth(0))
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "<password>hunter2</password>")
+
+	out.Reset()
+	err = ScrubXML(&out, strings.NewReader(
+		"<users><password>a</password><user><password>b</password></user></users>"),
+		nil, WithDepth(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "<users><password>********</password><user><password>b</password></user></users>", out.String())
+
+	// Invalid documents.
+	err = ScrubXML(&out, strings.NewReader("<users><password>a</users>"), nil)
+	assert.Error(t, err)
+}
+
+// TestScrubXMLLarge tests scrubbing a large XML document with repeated
+// sensitive elements.
+func TestScrubXMLLarge(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("<users>")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&input, "<user><name>user%d</name><password>secret%d</password></user>", i, i)
+	}
+	input.WriteString("</users>")
+
+	var out bytes.Buffer
+	err := ScrubXML(&out, strings.NewReader(input.String()), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "secret")
+	assert.Equal(t, 10000, strings.Count(out.String(), "<password>********</password>"))
+	assert.Contains(t, out.String(), "<name>user9999</name>")
+}
+
+// TestScrubXMLNamespaces tests scrubbing namespaced elements of third-party
+// XML documents by their local names.
+func TestScrubXMLNamespaces(t *testing.T) {
+	input := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">` +
+		`<soap:Body><auth:Login xmlns:auth="urn:auth">` +
+		`<auth:user>john</auth:user><auth:password>hunter2</auth:password>` +
+		`</auth:Login></soap:Body></soap:Envelope>`
+
+	var out bytes.Buffer
+	err := ScrubXML(&out, strings.NewReader(input), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.Contains(t, out.String(), ">********</password>")
+	assert.Contains(t, out.String(), ">john</user>")
+}